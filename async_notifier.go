@@ -0,0 +1,72 @@
+package witness
+
+import (
+	"context"
+	"log"
+)
+
+// DefaultQueueSize is the capacity of delivery queues unless configured otherwise.
+const DefaultQueueSize = 1024
+
+// AsyncNotifier delivers round trips to the wrapped Notifier from a background
+// goroutine, so that instrumented requests never wait for a notifier.
+type AsyncNotifier struct {
+	notifier Notifier
+	queue    *queue[RoundTripLog]
+	done     chan struct{}
+}
+
+// NewAsyncNotifier wraps n with a queue of given size, policy defines what
+// happens when n can not keep up and the queue is full.
+func NewAsyncNotifier(n Notifier, size int, policy OverflowPolicy) *AsyncNotifier {
+	a := &AsyncNotifier{
+		notifier: n,
+		queue:    newQueue[RoundTripLog](size, policy),
+		done:     make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Init initialises the wrapped notifier.
+func (a *AsyncNotifier) Init(ctx context.Context) {
+	a.notifier.Init(ctx)
+}
+
+// Notify queues round trip for delivery.
+func (a *AsyncNotifier) Notify(rtl RoundTripLog) {
+	a.queue.push(rtl)
+}
+
+// Stats reports counters of the delivery queue, including dropped round trips.
+func (a *AsyncNotifier) Stats() QueueStats {
+	return a.queue.stats()
+}
+
+// Close stops accepting round trips and waits until queued ones are delivered.
+func (a *AsyncNotifier) Close() {
+	a.queue.close()
+	<-a.done
+}
+
+func (a *AsyncNotifier) run() {
+	defer close(a.done)
+	for {
+		rtl, ok := a.queue.pop()
+		if !ok {
+			return
+		}
+		deliver(a.notifier, rtl)
+	}
+}
+
+// deliver notifies n recovering from panic, so that misbehaving notifier
+// does not crash delivery goroutine.
+func deliver(n Notifier, rtl RoundTripLog) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("witness: notifier panic: %v", r)
+		}
+	}()
+	n.Notify(rtl)
+}
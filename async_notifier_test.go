@@ -0,0 +1,39 @@
+package witness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncNotifier(t *testing.T) {
+	stuck := &chanNotifier{make(chan RoundTripLog)}
+	a := NewAsyncNotifier(stuck, 1, DropNewest)
+
+	notified := make(chan bool)
+	go func() {
+		for i := 0; i < 3; i++ {
+			a.Notify(RoundTripLog{})
+		}
+		notified <- true
+	}()
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("expected Notify not to wait for stuck notifier")
+	}
+
+	// at most one is being delivered and one queued
+	if stats := a.Stats(); stats.Dropped == 0 || stats.Enqueued+stats.Dropped != 3 {
+		t.Errorf("expected overflow to be counted, got %+v", stats)
+	}
+
+	go func() {
+		for range stuck.ch {
+		}
+	}()
+	a.Close()
+	if stats := a.Stats(); stats.Pending != 0 {
+		t.Errorf("expected queue to be drained on close, got %+v", stats)
+	}
+}
@@ -0,0 +1,178 @@
+package witness
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Body directions used in references and urls of stored bodies.
+const (
+	requestBody  = "request"
+	responseBody = "response"
+)
+
+// bodyStore keeps large bodies in temporary directory, files are named after
+// hash of their content, so that identical bodies are stored once. Bodies
+// of at most limit round trips are kept, the oldest are removed.
+type bodyStore struct {
+	mu     sync.Mutex
+	dir    string
+	limit  int
+	refs   map[string]map[string]string // round trip id -> direction -> hash
+	order  []string
+	counts map[string]int // hash -> number of references
+	closed bool
+}
+
+// errBodyStoreClosed is returned by put after the store is closed.
+var errBodyStoreClosed = errors.New("witness: body store is closed")
+
+func newBodyStore(limit int) *bodyStore {
+	return &bodyStore{
+		limit:  limit,
+		refs:   make(map[string]map[string]string),
+		counts: make(map[string]int),
+	}
+}
+
+// put stores body of the round trip and returns its hash.
+func (s *bodyStore) put(id, direction, body string) (string, error) {
+	sum := sha256.Sum256([]byte(body))
+	hash := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", errBodyStoreClosed
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "witness-bodies-")
+		if err != nil {
+			return "", fmt.Errorf("witness: storing body: %w", err)
+		}
+		s.dir = dir
+	}
+	if s.counts[hash] == 0 {
+		if err := os.WriteFile(filepath.Join(s.dir, hash), []byte(body), 0o600); err != nil {
+			return "", fmt.Errorf("witness: storing body: %w", err)
+		}
+	}
+
+	refs, ok := s.refs[id]
+	if !ok {
+		refs = make(map[string]string)
+		s.refs[id] = refs
+		s.order = append(s.order, id)
+	}
+	if previous, ok := refs[direction]; ok {
+		if previous == hash {
+			return hash, nil
+		}
+		s.release(previous)
+	}
+	refs[direction] = hash
+	s.counts[hash]++
+
+	for s.limit > 0 && len(s.order) > s.limit {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		for _, h := range s.refs[oldest] {
+			s.release(h)
+		}
+		delete(s.refs, oldest)
+	}
+	return hash, nil
+}
+
+// release drops reference to the file removing it when it is not used.
+func (s *bodyStore) release(hash string) {
+	s.counts[hash]--
+	if s.counts[hash] > 0 {
+		return
+	}
+	delete(s.counts, hash)
+	os.Remove(filepath.Join(s.dir, hash))
+}
+
+// get reads stored body of the round trip.
+func (s *bodyStore) get(id, direction string) (string, error) {
+	s.mu.Lock()
+	hash, ok := s.refs[id][direction]
+	dir := s.dir
+	s.mu.Unlock()
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	b, err := os.ReadFile(filepath.Join(dir, hash))
+	return string(b), err
+}
+
+// grow lets the store keep bodies of n more round trips, e.g. replayed ones.
+func (s *bodyStore) grow(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limit > 0 {
+		s.limit += n
+	}
+}
+
+// restore puts stored bodies back into the log.
+func (s *bodyStore) restore(rtl RoundTripLog) RoundTripLog {
+	if req := rtl.RequestLog; req != nil && req.BodyRef != "" {
+		if body, err := s.get(rtl.ID, requestBody); err == nil {
+			r := *req
+			r.Body, r.BodyRef = body, ""
+			rtl.RequestLog = &r
+		}
+	}
+	if res := rtl.ResponseLog; res != nil && res.BodyRef != "" {
+		if body, err := s.get(rtl.ID, responseBody); err == nil {
+			r := *res
+			r.Body, r.BodyRef = body, ""
+			rtl.ResponseLog = &r
+		}
+	}
+	return rtl
+}
+
+// ServeHTTP responds with stored body for /bodies/{id}/{direction}.
+func (s *bodyStore) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	body, err := s.get(req.PathValue("id"), req.PathValue("direction"))
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(rw, "witness: body not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// bodies are displayed as text, they must never be rendered as pages of
+	// the witness origin
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.Header().Set("Content-Security-Policy", "sandbox")
+	rw.Write([]byte(body))
+}
+
+// close removes stored bodies.
+func (s *bodyStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(s.dir)
+	s.dir = ""
+	s.refs = make(map[string]map[string]string)
+	s.order = nil
+	s.counts = make(map[string]int)
+	return err
+}
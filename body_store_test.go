@@ -0,0 +1,100 @@
+package witness
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodyStore(t *testing.T) {
+	s := newBodyStore(2)
+	defer s.close()
+
+	hash1, err := s.put("1", requestBody, "same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash2, _ := s.put("2", responseBody, "same")
+	if hash1 != hash2 {
+		t.Errorf("expected identical bodies to have the same reference, got %s and %s", hash1, hash2)
+	}
+	if files, _ := os.ReadDir(s.dir); len(files) != 1 {
+		t.Errorf("expected identical bodies to be stored once, got %d files", len(files))
+	}
+	if body, err := s.get("2", responseBody); err != nil || body != "same" {
+		t.Errorf("expected stored body, got %q %v", body, err)
+	}
+
+	// evicts the oldest round trip keeping file used by another one
+	s.put("3", requestBody, "other")
+	if _, err := s.get("1", requestBody); err == nil {
+		t.Error("expected bodies of the oldest round trip to be removed")
+	}
+	if body, _ := s.get("2", responseBody); body != "same" {
+		t.Errorf("expected shared file to be kept, got %q", body)
+	}
+
+	dir := s.dir
+	s.close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected directory to be removed, got %v", err)
+	}
+	if _, err := s.put("4", requestBody, "late"); err != errBodyStoreClosed {
+		t.Errorf("expected closed store to refuse bodies, got %v", err)
+	}
+}
+
+func TestSpill(t *testing.T) {
+	tr := NewSSENotifier(WithoutSSEServer(), WithSSEToken(""), WithSSESpillThreshold(5))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer tr.Close()
+	defer cancel()
+	tr.Start(ctx)
+	server := httptest.NewServer(tr.Handler(""))
+	defer server.Close()
+
+	stream, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	reader := bufio.NewReader(stream.Body)
+	// skip server.info
+	readEvent(reader)
+
+	rtl := sampleRoundTrip("spilled")
+	rtl.ResponseLog.Body = "large body"
+	tr.Notify(rtl)
+
+	event, _ := readEvent(reader)
+	if strings.Contains(event.data, "large body") || !strings.Contains(event.data, `"bodyRef"`) {
+		t.Errorf("expected event to carry reference instead of body, got %s", event.data)
+	}
+	if rtl.ResponseLog.Body != "large body" {
+		t.Error("expected log passed to notifier to be left intact")
+	}
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+	if status, body := get("/bodies/spilled/response"); status != http.StatusOK || body != "large body" {
+		t.Errorf("expected stored body to be served, got %d %q", status, body)
+	}
+	if status, _ := get("/bodies/spilled/request"); status != http.StatusNotFound {
+		t.Errorf("expected small body not to be stored, got %d", status)
+	}
+	if _, har := get("/export.har"); !strings.Contains(har, "large body") {
+		t.Errorf("expected exported HAR to include stored body, got %s", har)
+	}
+}
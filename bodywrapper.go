@@ -9,6 +9,8 @@ type bodyWrapper struct {
 	body           io.ReadCloser
 	readingStarted bool
 	content        []byte
+	limit          int64 // limit of captured bytes, negative for no limit
+	size           int64 // number of bytes read, including ones not captured
 	onReadingStart func()
 	onReadingDone  func()
 	onClose        func(*bodyWrapper)
@@ -27,11 +29,9 @@ func (bw *bodyWrapper) Read(p []byte) (n int, err error) {
 	}
 	n, err = bw.body.Read(p)
 	// fmt.Println(string(p), n, err)
-	if bw.content == nil {
-		bw.content = p[:n]
-	} else {
-		bw.content = append(bw.content, p[:n]...)
-	}
+	bw.size += int64(n)
+	// copy, as the caller is free to reuse p after Read returns
+	bw.content = appendLimited(bw.content, p[:n], bw.limit)
 	if err == io.EOF {
 		// fmt.Println("Read body", now.Sub(bw.readingStartedAt))
 		if bw.onReadingDone != nil {
@@ -42,6 +42,17 @@ func (bw *bodyWrapper) Read(p []byte) (n int, err error) {
 	return
 }
 
+// appendLimited appends p to content up to limit bytes, negative limit means
+// no limit.
+func appendLimited(content, p []byte, limit int64) []byte {
+	if limit >= 0 {
+		if free := limit - int64(len(content)); int64(len(p)) > free {
+			p = p[:max(free, 0)]
+		}
+	}
+	return append(content, p...)
+}
+
 // Close calls real body.Close and invokes internal callback to track time to closing.
 func (bw *bodyWrapper) Close() (err error) {
 	bw.onClose(bw)
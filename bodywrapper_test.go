@@ -2,6 +2,7 @@ package witness
 
 import (
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +22,25 @@ func TestBodyWrapperClose(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestBodyWrapperLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit     int64
+		captured  string
+		truncated bool
+	}{
+		{-1, "hello world", false},
+		{0, "", true},
+		{5, "hello", true},
+		{11, "hello world", false},
+	} {
+		bw := &bodyWrapper{body: io.NopCloser(strings.NewReader("hello world")), limit: tc.limit}
+		// small reads make sure limit is applied across them
+		io.CopyBuffer(io.Discard, struct{ io.Reader }{bw}, make([]byte, 3))
+		truncated := bw.size > int64(len(bw.content))
+		if string(bw.content) != tc.captured || truncated != tc.truncated || bw.size != 11 {
+			t.Errorf("limit %d: expected %q captured (truncated %v), got %q (%v) of %d bytes",
+				tc.limit, tc.captured, tc.truncated, bw.content, truncated, bw.size)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Command witness opens previously captured round trips (HAR or witness JSON
+// lines files) in the witness UI without the original process running.
+//
+//	witness [-addr localhost:8989] capture.har [more.jsonl ...]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/1602/witness"
+)
+
+func main() {
+	addr := flag.String("addr", witness.DefaultSSEAddr, "address of the UI server, use port 0 to pick a free one")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s file.har|file.jsonl ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var logs []witness.RoundTripLog
+	for _, path := range flag.Args() {
+		loaded, err := witness.LoadCapture(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loading %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("loaded %d round trips from %s\n", len(loaded), path)
+		logs = append(logs, loaded...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	n := witness.NewSSENotifier(witness.WithSSEAddr(*addr))
+	n.Replay(logs)
+	if err := n.Start(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("open %s to view captured round trips\n", n.URL())
+
+	<-ctx.Done()
+}
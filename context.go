@@ -0,0 +1,32 @@
+package witness
+
+import "context"
+
+type contextKey int
+
+const (
+	parentIDKey contextKey = iota
+	spanKey
+)
+
+// contextWithParentID returns a copy of ctx carrying id of the inbound round
+// trip on behalf of which outbound requests are made.
+func contextWithParentID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, parentIDKey, id)
+}
+
+// ParentIDFromContext returns id of the inbound round trip recorded by
+// Middleware in ctx, if any.
+func ParentIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(parentIDKey).(string)
+	return id, ok
+}
+
+func contextWithSpan(ctx context.Context, sc spanContext) context.Context {
+	return context.WithValue(ctx, spanKey, sc)
+}
+
+func spanFromContext(ctx context.Context) (spanContext, bool) {
+	sc, ok := ctx.Value(spanKey).(spanContext)
+	return sc, ok
+}
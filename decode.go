@@ -0,0 +1,110 @@
+package witness
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decodedBody is captured body prepared for display.
+type decodedBody struct {
+	content []byte
+	// encoding is the content encoding content was decoded from
+	encoding string
+	// truncated is set when decoded content is cut at limit or incomplete
+	truncated bool
+	// err explains why content is left encoded
+	err string
+}
+
+// decodeBody decodes captured content according to Content-Encoding header
+// value, decoded content is limited to limit bytes unless it is negative.
+// Content is returned as is when encoding is not supported or malformed.
+func decodeBody(content []byte, contentEncoding string, limit int64) decodedBody {
+	var encodings []string
+	for _, e := range strings.Split(contentEncoding, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "identity" {
+			encodings = append(encodings, e)
+		}
+	}
+	if len(encodings) == 0 || len(content) == 0 {
+		return decodedBody{content: content}
+	}
+
+	decoded := decodedBody{content: content, encoding: contentEncoding}
+	// encodings are listed in order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		r, err := decoder(encodings[i], decoded.content)
+		if err != nil {
+			return decodedBody{content: content, err: err.Error()}
+		}
+		out, truncated, err := readLimited(r, limit)
+		// captured prefix of the body ends unexpectedly, show what is decoded
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			truncated = true
+		} else if err != nil {
+			return decodedBody{content: content, err: fmt.Sprintf("decoding %s: %v", encodings[i], err)}
+		}
+		decoded.content = out
+		decoded.truncated = decoded.truncated || truncated
+	}
+	return decoded
+}
+
+func decoder(encoding string, content []byte) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", encoding, err)
+		}
+		return r, nil
+	case "deflate":
+		// deflate is meant to be zlib wrapped, though some servers send raw
+		// deflate stream
+		if r, err := zlib.NewReader(bytes.NewReader(content)); err == nil {
+			return r, nil
+		}
+		return flate.NewReader(bytes.NewReader(content)), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+}
+
+// readLimited reads up to limit bytes reporting whether there were more,
+// negative limit means no limit.
+func readLimited(r io.Reader, limit int64) ([]byte, bool, error) {
+	if limit < 0 {
+		b, err := io.ReadAll(r)
+		return b, false, err
+	}
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(b)) > limit {
+		return b[:limit], true, err
+	}
+	return b, false, err
+}
+
+// captureBody sets body of the request from captured content of size bytes.
+func (r *RequestLog) captureBody(content []byte, size, limit int64) {
+	decoded := decodeBody(content, r.Header.Get("Content-Encoding"), limit)
+	r.Body = string(decoded.content)
+	r.BodySize = size
+	r.BodyTruncated = size > int64(len(content)) || decoded.truncated
+	r.BodyEncoding = decoded.encoding
+	r.BodyDecodingError = decoded.err
+}
+
+// captureBody sets body of the response from captured content of size bytes.
+func (r *ResponseLog) captureBody(content []byte, size, limit int64) {
+	decoded := decodeBody(content, r.Header.Get("Content-Encoding"), limit)
+	r.Body = string(decoded.content)
+	r.BodySize = size
+	r.BodyTruncated = size > int64(len(content)) || decoded.truncated
+	r.BodyEncoding = decoded.encoding
+	r.BodyDecodingError = decoded.err
+}
@@ -0,0 +1,100 @@
+package witness
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compress(t *testing.T, encoding, s string) []byte {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	case "raw deflate":
+		w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+	}
+	io.WriteString(w, s)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	hello := "hello, hello, hello"
+	gzipped := compress(t, "gzip", hello)
+
+	for _, tc := range []struct {
+		name      string
+		content   []byte
+		encoding  string
+		limit     int64
+		expected  string
+		truncated bool
+		err       string
+	}{
+		{"identity", []byte(hello), "", -1, hello, false, ""},
+		{"gzip", gzipped, "gzip", -1, hello, false, ""},
+		{"deflate", compress(t, "deflate", hello), "deflate", -1, hello, false, ""},
+		{"raw deflate", compress(t, "raw deflate", hello), "Deflate", -1, hello, false, ""},
+		{"several", compress(t, "gzip", string(compress(t, "deflate", hello))), "deflate, gzip", -1, hello, false, ""},
+		{"decoded limit", gzipped, "gzip", 5, "hello", true, ""},
+		{"unsupported", []byte("br bytes"), "br", -1, "br bytes", false, "unsupported content encoding br"},
+		{"malformed", []byte("plain text body"), "gzip", -1, "plain text body", false, "decoding gzip: gzip: invalid header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := decodeBody(tc.content, tc.encoding, tc.limit)
+			if string(d.content) != tc.expected || d.truncated != tc.truncated || d.err != tc.err {
+				t.Errorf("expected %q (truncated %v, error %q), got %q (%v, %q)",
+					tc.expected, tc.truncated, tc.err, d.content, d.truncated, d.err)
+			}
+		})
+	}
+
+	t.Run("captured prefix", func(t *testing.T) {
+		long := strings.Repeat("0123456789", 1000)
+		content := compress(t, "gzip", long)
+		d := decodeBody(content[:len(content)/2], "gzip", -1)
+		if !d.truncated || d.err != "" || !strings.HasPrefix(long, string(d.content)) {
+			t.Errorf("expected decoded prefix, got %d bytes (truncated %v, error %q)", len(d.content), d.truncated, d.err)
+		}
+	})
+}
+
+func TestCompressedBody(t *testing.T) {
+	gzipped := compress(t, "gzip", `{"ok":true}`)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped)
+	}))
+	defer testServer.Close()
+
+	notifier := &fakeNotifier{}
+	client := &http.Client{}
+	Instrument(client, WithNotifier(notifier), WithBodyCapture(true))
+	req, _ := http.NewRequest("GET", testServer.URL, nil)
+	// transport does not decompress when caller asks for encoding itself
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if !bytes.Equal(body, gzipped) {
+		t.Error("expected caller to receive compressed body")
+	}
+	resLog := notifier.payload.ResponseLog
+	if resLog.Body != `{"ok":true}` || resLog.BodyEncoding != "gzip" || resLog.BodySize != int64(len(gzipped)) {
+		t.Errorf("expected body decoded for display, got %+v", resLog)
+	}
+}
@@ -2,6 +2,8 @@ module github.com/1602/witness/example/k8s
 
 go 1.22.0
 
+replace github.com/1602/witness => ../..
+
 require (
 	github.com/1602/witness v0.0.0-20240217221752-2fd5278c3a58
 	k8s.io/apimachinery v0.29.2
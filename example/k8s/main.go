@@ -9,7 +9,6 @@ import (
 	"github.com/1602/witness"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/client-go/util/homedir"
@@ -33,11 +32,14 @@ func main() {
 		InteractiveMode:    api.IfAvailableExecInteractiveMode,
 	}
 
-	cl, err := rest.HTTPClientFor(config)
-	witness.DebugClient(cl, context.TODO())
+	witness.DefaultNotifier.Init(context.TODO())
+	config.Wrap(witness.Wrapper(
+		witness.WithNotifier(witness.DefaultNotifier),
+		witness.WithBodyCapture(true),
+	))
 
 	// create the clientset
-	clientset, err := kubernetes.NewForConfigAndClient(config, cl)
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -0,0 +1,183 @@
+package witness
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileNotifier appends every completed round trip as a line of JSON to a
+// file, rotating it by size and age. Files could be opened with LoadCapture.
+type FileNotifier struct {
+	// Path of the current file, rotated segments are stored next to it with
+	// a timestamp added to the name.
+	Path string
+	// MaxSize in bytes triggers rotation when exceeded, 0 disables it.
+	MaxSize int64
+	// MaxAge of the current file triggers rotation when exceeded, 0 disables it.
+	MaxAge time.Duration
+	// Compress rotated segments with gzip.
+	Compress bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	compress sync.WaitGroup
+}
+
+// NewFileNotifier creates notifier appending round trips to the file at path.
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{Path: path}
+}
+
+// Init closes the file when ctx is done.
+func (f *FileNotifier) Init(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		if err := f.Close(); err != nil {
+			log.Println("witness: closing capture file failed:", err)
+		}
+	}()
+}
+
+// Notify writes completed round trip, intermediate updates are ignored, as
+// well as round trips notified after Close.
+func (f *FileNotifier) Notify(rtl RoundTripLog) {
+	if !rtl.Done {
+		return
+	}
+	line, err := json.Marshal(rtl)
+	if err != nil {
+		log.Println("witness: serializing round trip failed:", err)
+		return
+	}
+	line = append(line, '\n')
+	if err := f.write(line); err != nil {
+		log.Println("witness: writing capture file failed:", err)
+	}
+}
+
+func (f *FileNotifier) write(line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	if f.file != nil && f.shouldRotate(int64(len(line))) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+func (f *FileNotifier) shouldRotate(incoming int64) bool {
+	if f.MaxSize > 0 && f.size > 0 && f.size+incoming > f.MaxSize {
+		return true
+	}
+	return f.MaxAge > 0 && time.Since(f.openedAt) > f.MaxAge
+}
+
+func (f *FileNotifier) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+// rotate closes current file and renames it into a timestamped segment.
+func (f *FileNotifier) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	segment := f.segmentPath(time.Now())
+	if err := os.Rename(f.Path, segment); err != nil {
+		return err
+	}
+	if f.Compress {
+		f.compress.Add(1)
+		go func() {
+			defer f.compress.Done()
+			if err := gzipFile(segment); err != nil {
+				log.Println("witness: compressing capture file failed:", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (f *FileNotifier) segmentPath(t time.Time) string {
+	ext := filepath.Ext(f.Path)
+	base := strings.TrimSuffix(f.Path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.UTC().Format("20060102T150405.000000000"), ext)
+}
+
+// Close closes current file and waits for pending compression of rotated
+// segments. Round trips are not written afterwards.
+func (f *FileNotifier) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.compress.Wait()
+	return err
+}
+
+// gzipFile replaces file at path with its compressed version at path.gz
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,89 @@
+package witness
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileNotifier(t *testing.T) {
+	t.Run("appends completed round trips", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "capture.jsonl")
+		n := NewFileNotifier(path)
+		n.Notify(RoundTripLog{ID: "pending"})
+		n.Notify(sampleRoundTrip("1"))
+		n.Notify(sampleRoundTrip("2"))
+		if err := n.Close(); err != nil {
+			t.Fatal(err)
+		}
+		n.Notify(sampleRoundTrip("3"))
+
+		logs, err := LoadCapture(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 2 || logs[0].ID != "1" || logs[1].ID != "2" {
+			t.Errorf("expected two completed round trips, got %+v", logs)
+		}
+		if info, err := os.Stat(path); err != nil {
+			t.Error(err)
+		} else if info.Mode().Perm() != 0o600 {
+			t.Errorf("expected file to be readable by owner only, got %v", info.Mode())
+		}
+	})
+
+	t.Run("rotates by size and compresses segments", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "capture.jsonl")
+		n := NewFileNotifier(path)
+		n.MaxSize = 10
+		n.Compress = true
+		for _, id := range []string{"1", "2", "3"} {
+			n.Notify(sampleRoundTrip(id))
+		}
+		if err := n.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		segments, _ := filepath.Glob(filepath.Join(dir, "capture-*.jsonl.gz"))
+		if len(segments) != 2 {
+			t.Fatalf("expected two compressed segments, got %v", segments)
+		}
+		for _, segment := range segments {
+			logs, err := LoadCapture(segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logs) != 1 {
+				t.Errorf("expected one round trip per segment, got %d", len(logs))
+			}
+		}
+		logs, _ := LoadCapture(path)
+		if len(logs) != 1 || logs[0].ID != "3" {
+			t.Errorf("expected current file to hold the latest round trip, got %+v", logs)
+		}
+	})
+
+	t.Run("rotates by age", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "capture.jsonl")
+		n := NewFileNotifier(path)
+		n.MaxAge = time.Hour
+		n.Notify(sampleRoundTrip("1"))
+		n.openedAt = time.Now().Add(-2 * time.Hour)
+		n.Notify(sampleRoundTrip("2"))
+		n.Close()
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 2 {
+			t.Errorf("expected current file and one segment, got %d files", len(entries))
+		}
+		for _, e := range entries {
+			if e.Name() != "capture.jsonl" && !strings.HasPrefix(e.Name(), "capture-") {
+				t.Errorf("unexpected file %v", e.Name())
+			}
+		}
+	})
+}
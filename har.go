@@ -0,0 +1,361 @@
+package witness
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HAR 1.2 format, see http://www.softwareishard.com/blog/har-12-spec/
+// Fields prefixed with underscore are witness specific extensions.
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+
+	ID           string    `json:"_id,omitempty"`
+	Direction    Direction `json:"_direction,omitempty"`
+	ParentID     string    `json:"_parentId,omitempty"`
+	TraceID      string    `json:"_traceId,omitempty"`
+	SpanID       string    `json:"_spanId,omitempty"`
+	ParentSpanID string    `json:"_parentSpanId,omitempty"`
+	Events       []Event   `json:"_events,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// harTimings are in milliseconds, -1 when the phase does not apply.
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	list := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			list = append(list, harNameValue{name, value})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func harQuery(query url.Values) []harNameValue {
+	return harHeaders(http.Header(query))
+}
+
+// toHAREntry converts round trip log to HAR entry deriving timings from
+// the timeline events.
+func toHAREntry(rtl RoundTripLog) harEntry {
+	entry := harEntry{
+		Time:         float64(rtl.DurationNano) / float64(time.Millisecond),
+		ID:           rtl.ID,
+		Direction:    rtl.Direction,
+		ParentID:     rtl.ParentID,
+		TraceID:      rtl.TraceID,
+		SpanID:       rtl.SpanID,
+		ParentSpanID: rtl.ParentSpanID,
+		Request: harRequest{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+
+	if req := rtl.RequestLog; req != nil {
+		entry.Request.Method = req.Method
+		entry.Request.URL = req.Url
+		entry.Request.Headers = harHeaders(req.Header)
+		entry.Request.QueryString = harQuery(req.Query)
+		if req.Body != "" {
+			entry.Request.BodySize = max(req.BodySize, int64(len(req.Body)))
+			entry.Request.PostData = &harPostData{
+				MimeType: req.Header.Get("Content-Type"),
+				Text:     req.Body,
+			}
+		}
+	}
+
+	if res := rtl.ResponseLog; res != nil {
+		entry.Request.HTTPVersion = res.Proto
+		entry.Response.HTTPVersion = res.Proto
+		entry.Response.Status = res.StatusCode
+		entry.Response.StatusText = http.StatusText(res.StatusCode)
+		entry.Response.Headers = harHeaders(res.Header)
+		entry.Response.RedirectURL = res.Header.Get("Location")
+		entry.Response.BodySize = res.ContentLength
+		entry.Response.Content = harContent{
+			Size:     res.ContentLength,
+			MimeType: res.Header.Get("Content-Type"),
+			Text:     res.Body,
+		}
+	}
+
+	if rtl.Error != nil {
+		entry.Comment = rtl.Error.Message
+	}
+
+	if tl := rtl.Timeline; tl != nil {
+		entry.StartedDateTime = tl.StartedAt
+		entry.Events = tl.Events
+		entry.Timings = harTimingsOf(tl, rtl.DurationNano)
+	}
+
+	return entry
+}
+
+// harTimingsOf splits duration of a round trip into HAR phases using trace events.
+func harTimingsOf(tl *Timeline, durationNano int64) harTimings {
+	at := make(map[string]int64, len(tl.Events))
+	for _, e := range tl.Events {
+		if _, seen := at[e.Name]; !seen {
+			at[e.Name] = e.Delay
+		}
+	}
+	span := func(from, to string) float64 {
+		start, okStart := at[from]
+		end, okEnd := at[to]
+		if !okStart || !okEnd || end < start {
+			return -1
+		}
+		return float64(end-start) / float64(time.Millisecond)
+	}
+	ms := func(nano int64) float64 {
+		return float64(nano) / float64(time.Millisecond)
+	}
+
+	timings := harTimings{
+		DNS:     span("DNSStart", "DNSDone"),
+		Connect: span("ConnectStart", "ConnectDone"),
+		SSL:     span("TLSHandshakeStart", "TLSHandshakeDone"),
+		Send:    span("GotConn", "WroteRequest"),
+		Wait:    span("WroteRequest", "GotFirstResponseByte"),
+	}
+	if timings.Connect >= 0 && timings.SSL >= 0 {
+		// HAR connect time includes ssl, while ConnectDone is traced before handshake
+		timings.Connect += timings.SSL
+	}
+
+	if _, ok := at["GotConn"]; !ok {
+		// not a client round trip (or it failed before getting connection),
+		// attribute whole duration to waiting for response
+		timings.Blocked = -1
+		timings.Send = 0
+		timings.Wait = ms(durationNano)
+		timings.Receive = 0
+		return timings
+	}
+
+	blockedUntil := at["GotConn"]
+	for _, name := range []string{"ConnectStart", "DNSStart"} {
+		if delay, ok := at[name]; ok && delay < blockedUntil {
+			blockedUntil = delay
+		}
+	}
+	timings.Blocked = ms(blockedUntil)
+
+	if first, ok := at["GotFirstResponseByte"]; ok {
+		end := durationNano
+		if done, ok := at["ResponseBodyReadingDone"]; ok {
+			end = done
+		}
+		if end >= first {
+			timings.Receive = ms(end - first)
+		}
+	}
+
+	// HAR requires send, wait and receive to be non-negative
+	for _, t := range []*float64{&timings.Send, &timings.Wait, &timings.Receive} {
+		if *t < 0 {
+			*t = 0
+		}
+	}
+	return timings
+}
+
+// harArchive accumulates completed round trips to be exported as HAR.
+type harArchive struct {
+	mu    sync.Mutex
+	limit int
+	logs  []RoundTripLog
+	// bodies restores bodies stored separately, when set
+	bodies *bodyStore
+}
+
+// add stores completed round trip, the oldest one is evicted when limit is reached.
+func (a *harArchive) add(rtl RoundTripLog) {
+	if !rtl.Done {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.limit > 0 && len(a.logs) >= a.limit {
+		a.logs = append(a.logs[:0], a.logs[1:]...)
+	}
+	a.logs = append(a.logs, rtl)
+}
+
+func (a *harArchive) document() harDocument {
+	a.mu.Lock()
+	logs := append([]RoundTripLog(nil), a.logs...)
+	a.mu.Unlock()
+
+	entries := make([]harEntry, 0, len(logs))
+	for _, rtl := range logs {
+		if a.bodies != nil {
+			rtl = a.bodies.restore(rtl)
+		}
+		entries = append(entries, toHAREntry(rtl))
+	}
+	return harDocument{harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "witness", Version: "1"},
+		Entries: entries,
+	}}
+}
+
+// writeHAR writes archived round trips in HAR format.
+func (a *harArchive) writeHAR(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a.document())
+}
+
+// ServeHTTP responds with HAR file download.
+func (a *harArchive) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Disposition", `attachment; filename="witness.har"`)
+	if err := a.writeHAR(rw); err != nil {
+		log.Println("witness: har export failed:", err)
+	}
+}
+
+// HARNotifier collects completed round trips and writes them as a HAR file
+// when context passed to Init is done or Close is called.
+type HARNotifier struct {
+	Path    string
+	archive harArchive
+	once    sync.Once
+	err     error
+}
+
+// NewHARNotifier creates notifier writing HAR file to the path on shutdown.
+func NewHARNotifier(path string) *HARNotifier {
+	return &HARNotifier{Path: path}
+}
+
+func (h *HARNotifier) Init(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		if err := h.Close(); err != nil {
+			log.Println("witness: writing har file failed:", err)
+		}
+	}()
+}
+
+func (h *HARNotifier) Notify(rtl RoundTripLog) {
+	h.archive.add(rtl)
+}
+
+// WriteHAR writes collected round trips in HAR format.
+func (h *HARNotifier) WriteHAR(w io.Writer) error {
+	return h.archive.writeHAR(w)
+}
+
+// Close writes HAR file, subsequent calls return result of the first one.
+func (h *HARNotifier) Close() error {
+	h.once.Do(func() {
+		f, err := os.Create(h.Path)
+		if err != nil {
+			h.err = err
+			return
+		}
+		if err := h.WriteHAR(f); err != nil {
+			f.Close()
+			h.err = err
+			return
+		}
+		h.err = f.Close()
+	})
+	return h.err
+}
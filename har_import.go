@@ -0,0 +1,194 @@
+package witness
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReadHAR converts entries of HAR document into round trip logs.
+func ReadHAR(r io.Reader) ([]RoundTripLog, error) {
+	var doc harDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding har: %w", err)
+	}
+	logs := make([]RoundTripLog, 0, len(doc.Log.Entries))
+	for _, entry := range doc.Log.Entries {
+		logs = append(logs, fromHAREntry(entry))
+	}
+	return logs, nil
+}
+
+// ReadJSONL reads round trip logs stored as JSON lines.
+func ReadJSONL(r io.Reader) ([]RoundTripLog, error) {
+	logs := []RoundTripLog{}
+	dec := json.NewDecoder(r)
+	for {
+		var rtl RoundTripLog
+		err := dec.Decode(&rtl)
+		if err == io.EOF {
+			return logs, nil
+		}
+		if err != nil {
+			return logs, fmt.Errorf("decoding jsonl line %d: %w", len(logs)+1, err)
+		}
+		logs = append(logs, rtl)
+	}
+}
+
+// LoadCapture reads round trip logs from HAR or witness JSON lines file,
+// optionally gzip compressed.
+func LoadCapture(path string) ([]RoundTripLog, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		content, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if isHAR(content) {
+		return ReadHAR(bytes.NewReader(content))
+	}
+	return ReadJSONL(bytes.NewReader(content))
+}
+
+// isHAR tells whether the first JSON value of content is a HAR document.
+func isHAR(content []byte) bool {
+	var probe struct {
+		Log *json.RawMessage `json:"log"`
+	}
+	line, _ := bufio.NewReader(bytes.NewReader(content)).ReadBytes('\n')
+	if json.Unmarshal(line, &probe) == nil {
+		return probe.Log != nil
+	}
+	// pretty printed document spans multiple lines
+	return json.Unmarshal(content, &probe) == nil && probe.Log != nil
+}
+
+func fromHARHeaders(list []harNameValue) http.Header {
+	header := make(http.Header, len(list))
+	for _, h := range list {
+		header.Add(h.Name, h.Value)
+	}
+	return header
+}
+
+// fromHAREntry converts HAR entry into completed round trip log, timeline
+// is restored from witness extension or synthesized from HAR timings.
+func fromHAREntry(entry harEntry) RoundTripLog {
+	duration := time.Duration(entry.Time * float64(time.Millisecond))
+	rtl := RoundTripLog{
+		ID:           entry.ID,
+		Direction:    entry.Direction,
+		ParentID:     entry.ParentID,
+		TraceID:      entry.TraceID,
+		SpanID:       entry.SpanID,
+		ParentSpanID: entry.ParentSpanID,
+		Duration:     roundDuration(duration, 1).String(),
+		DurationNano: duration.Nanoseconds(),
+		Done:         true,
+	}
+	if rtl.ID == "" {
+		rtl.ID = uuid.NewString()
+	}
+	if rtl.Direction == "" {
+		rtl.Direction = Outbound
+	}
+
+	query := url.Values(fromHARHeaders(entry.Request.QueryString))
+	rtl.RequestLog = &RequestLog{
+		Method: entry.Request.Method,
+		Url:    entry.Request.URL,
+		Query:  query,
+		Header: fromHARHeaders(entry.Request.Headers),
+	}
+	if entry.Request.PostData != nil {
+		rtl.RequestLog.Body = entry.Request.PostData.Text
+		rtl.RequestLog.BodySize = max(entry.Request.BodySize, int64(len(rtl.RequestLog.Body)))
+		rtl.RequestLog.BodyTruncated = rtl.RequestLog.BodySize > int64(len(rtl.RequestLog.Body))
+	}
+
+	if entry.Response.Status != 0 {
+		rtl.ResponseLog = &ResponseLog{
+			Proto:         entry.Response.HTTPVersion,
+			Status:        fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText),
+			StatusCode:    entry.Response.Status,
+			Header:        fromHARHeaders(entry.Response.Headers),
+			ContentLength: entry.Response.Content.Size,
+			Body:          entry.Response.Content.Text,
+		}
+		res := rtl.ResponseLog
+		if res.Body != "" {
+			res.BodySize = max(res.ContentLength, int64(len(res.Body)))
+			res.BodyTruncated = res.BodySize > int64(len(res.Body))
+		}
+	}
+
+	if entry.Comment != "" && rtl.ResponseLog == nil {
+		rtl.Error = &RequestError{Message: entry.Comment}
+	}
+
+	events := entry.Events
+	if events == nil {
+		events = harTimingsEvents(entry.Timings)
+	}
+	rtl.Timeline = &Timeline{
+		StartedAt: entry.StartedDateTime,
+		Events:    events,
+	}
+	return rtl
+}
+
+// harTimingsEvents synthesizes timeline events from HAR timings.
+func harTimingsEvents(timings harTimings) []Event {
+	events := []Event{}
+	var at float64
+	phase := func(duration float64, start, done string) {
+		if duration < 0 {
+			return
+		}
+		if start != "" {
+			events = append(events, Event{Name: start, Delay: msToNano(at)})
+		}
+		at += duration
+		events = append(events, Event{Name: done, Delay: msToNano(at)})
+	}
+	events = append(events, Event{Name: "GetConn"})
+	if timings.Blocked > 0 {
+		at += timings.Blocked
+	}
+	phase(timings.DNS, "DNSStart", "DNSDone")
+	connect := timings.Connect
+	if connect >= 0 && timings.SSL >= 0 {
+		// HAR connect time includes ssl
+		connect -= timings.SSL
+	}
+	phase(connect, "ConnectStart", "ConnectDone")
+	phase(timings.SSL, "TLSHandshakeStart", "TLSHandshakeDone")
+	events = append(events, Event{Name: "GotConn", Delay: msToNano(at)})
+	phase(timings.Send, "", "WroteRequest")
+	phase(timings.Wait, "", "GotFirstResponseByte")
+	phase(timings.Receive, "", "ResponseBodyReadingDone")
+	return events
+}
+
+func msToNano(ms float64) int64 {
+	return int64(ms * float64(time.Millisecond))
+}
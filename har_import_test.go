@@ -0,0 +1,101 @@
+package witness
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadHAR(t *testing.T) {
+	t.Run("witness export", func(t *testing.T) {
+		a := &harArchive{}
+		a.add(sampleRoundTrip("1"))
+		var buf bytes.Buffer
+		if err := a.writeHAR(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		logs, err := ReadHAR(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 1 {
+			t.Fatalf("expected one log, got %d", len(logs))
+		}
+		original := sampleRoundTrip("1")
+		rtl := logs[0]
+		if rtl.ID != "1" || !rtl.Done || rtl.DurationNano != original.DurationNano {
+			t.Errorf("unexpected log %+v", rtl)
+		}
+		if rtl.RequestLog.Body != "hello" || rtl.ResponseLog.Body != "{}" {
+			t.Error("expected bodies to be restored")
+		}
+		if len(rtl.Timeline.Events) != len(original.Timeline.Events) {
+			t.Errorf("expected timeline events to be restored, got %+v", rtl.Timeline.Events)
+		}
+		if !rtl.Timeline.StartedAt.Equal(original.Timeline.StartedAt) {
+			t.Errorf("unexpected start %v", rtl.Timeline.StartedAt)
+		}
+	})
+
+	t.Run("foreign har", func(t *testing.T) {
+		doc := `{"log": {"version": "1.2", "entries": [{
+			"startedDateTime": "2024-01-01T00:00:00.000Z",
+			"time": 50.5,
+			"request": {"method": "GET", "url": "https://example.com/", "headers": [{"name": "Accept", "value": "*/*"}], "queryString": []},
+			"response": {"status": 404, "statusText": "Not Found", "headers": [], "content": {"size": 3, "mimeType": "text/plain", "text": "nah"}},
+			"timings": {"blocked": 1, "dns": 2, "connect": 10, "ssl": 6, "send": 0.5, "wait": 30, "receive": 1}
+		}]}}`
+		logs, err := ReadHAR(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rtl := logs[0]
+		if rtl.ID == "" || rtl.Direction != Outbound {
+			t.Error("expected id and direction to be defaulted")
+		}
+		if rtl.ResponseLog.StatusCode != 404 || rtl.ResponseLog.Body != "nah" {
+			t.Errorf("unexpected response %+v", rtl.ResponseLog)
+		}
+		if rtl.RequestLog.Header.Get("Accept") != "*/*" {
+			t.Error("expected request headers to be restored")
+		}
+
+		timings := harTimingsOf(rtl.Timeline, rtl.DurationNano)
+		if timings.DNS != 2 || timings.Connect != 10 || timings.SSL != 6 || timings.Wait != 30 {
+			t.Errorf("expected synthesized events to reproduce timings, got %+v", timings)
+		}
+	})
+}
+
+func TestLoadCapture(t *testing.T) {
+	dir := t.TempDir()
+
+	harPath := filepath.Join(dir, "capture.har")
+	n := NewHARNotifier(harPath)
+	n.Notify(sampleRoundTrip("1"))
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonlPath := filepath.Join(dir, "capture.jsonl")
+	var buf bytes.Buffer
+	for _, id := range []string{"1", "2"} {
+		json.NewEncoder(&buf).Encode(sampleRoundTrip(id))
+	}
+	os.WriteFile(jsonlPath, buf.Bytes(), 0644)
+
+	cases := map[string]int{harPath: 1, jsonlPath: 2}
+	for path, count := range cases {
+		logs, err := LoadCapture(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != count {
+			t.Errorf("expected %d logs in %s, got %d", count, path, len(logs))
+		}
+	}
+}
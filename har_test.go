@@ -0,0 +1,118 @@
+package witness
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sampleRoundTrip(id string) RoundTripLog {
+	ms := int64(time.Millisecond)
+	return RoundTripLog{
+		ID:        id,
+		Direction: Outbound,
+		RequestLog: &RequestLog{
+			Method: "POST",
+			Url:    "http://example.com/status?a=2",
+			Query:  map[string][]string{"a": {"2"}},
+			Header: http.Header{"Content-Type": {"text/plain"}},
+			Body:   "hello",
+		},
+		ResponseLog: &ResponseLog{
+			Proto:         "HTTP/1.1",
+			Status:        "200 OK",
+			StatusCode:    200,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			ContentLength: 2,
+			Body:          "{}",
+		},
+		Timeline: &Timeline{
+			StartedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Events: []Event{
+				{Name: "GetConn", Delay: 0},
+				{Name: "DNSStart", Delay: 1 * ms},
+				{Name: "DNSDone", Delay: 3 * ms},
+				{Name: "ConnectStart", Delay: 3 * ms},
+				{Name: "ConnectDone", Delay: 6 * ms},
+				{Name: "GotConn", Delay: 6 * ms},
+				{Name: "WroteRequest", Delay: 7 * ms},
+				{Name: "GotFirstResponseByte", Delay: 17 * ms},
+				{Name: "ResponseBodyReadingDone", Delay: 19 * ms},
+			},
+		},
+		DurationNano: 20 * ms,
+		Done:         true,
+	}
+}
+
+func TestToHAREntry(t *testing.T) {
+	entry := toHAREntry(sampleRoundTrip("1"))
+
+	expected := harTimings{Blocked: 1, DNS: 2, Connect: 3, SSL: -1, Send: 1, Wait: 10, Receive: 2}
+	if entry.Timings != expected {
+		t.Errorf("expected timings %+v, got %+v", expected, entry.Timings)
+	}
+	if entry.Time != 20 {
+		t.Errorf("expected time 20ms, got %v", entry.Time)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != "hello" {
+		t.Error("expected request body to be exported as post data")
+	}
+	if entry.Response.Content.Text != "{}" || entry.Response.Content.MimeType != "application/json" {
+		t.Errorf("unexpected response content %+v", entry.Response.Content)
+	}
+	if len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0].Value != "2" {
+		t.Errorf("unexpected query string %+v", entry.Request.QueryString)
+	}
+}
+
+func TestHARArchive(t *testing.T) {
+	a := &harArchive{limit: 2}
+	a.add(RoundTripLog{ID: "pending"})
+	a.add(sampleRoundTrip("1"))
+	a.add(sampleRoundTrip("2"))
+	a.add(sampleRoundTrip("3"))
+
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, httptest.NewRequest("GET", "/export.har", nil))
+
+	var doc harDocument
+	if err := json.NewDecoder(rw.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Log.Version != "1.2" {
+		t.Errorf("unexpected version %v", doc.Log.Version)
+	}
+	if len(doc.Log.Entries) != 2 || doc.Log.Entries[0].ID != "2" || doc.Log.Entries[1].ID != "3" {
+		t.Errorf("expected two most recent entries, got %+v", doc.Log.Entries)
+	}
+}
+
+func TestHARNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.har")
+	n := NewHARNotifier(path)
+	ctx, cancel := context.WithCancel(context.Background())
+	n.Init(ctx)
+	n.Notify(sampleRoundTrip("1"))
+	cancel()
+
+	if err := n.Close(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc harDocument
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Log.Entries) != 1 {
+		t.Errorf("expected one entry, got %d", len(doc.Log.Entries))
+	}
+}
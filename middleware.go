@@ -0,0 +1,228 @@
+package witness
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Middleware wraps handler to report inbound requests and responses written
+// by the handler. It accepts the same options as NewTransport.
+func Middleware(next http.Handler, opts ...Option) http.Handler {
+	return &middleware{
+		next:     next,
+		settings: NewTransport(nil, opts...),
+	}
+}
+
+type middleware struct {
+	next http.Handler
+	// settings holds configuration shared with outbound instrumentation,
+	// Base round tripper is not used.
+	settings *Transport
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	includeBody := m.settings.CaptureBody
+
+	startedAt := time.Now()
+	timeline := newTimeline(startedAt)
+	payload := &RoundTripLog{
+		ID:        uuid.NewString(),
+		Direction: Inbound,
+		RequestLog: &RequestLog{
+			Method: req.Method,
+			Url:    requestURL(req),
+			Query:  req.URL.Query(),
+			Header: req.Header.Clone(),
+		},
+		Timeline: timeline,
+	}
+
+	parent, _ := parseTraceparent(req.Header.Get(TraceparentHeader))
+	span := parent.child()
+	payload.TraceID = span.TraceID()
+	payload.SpanID = span.SpanID()
+	if parent.isValid() {
+		payload.ParentSpanID = parent.SpanID()
+	}
+	rec := newRecorder(m.settings.notifier(), m.settings.redactor(), payload)
+
+	ctx := contextWithParentID(req.Context(), payload.ID)
+	req = req.WithContext(contextWithSpan(ctx, span))
+
+	var requestBody *bodyWrapper
+	if includeBody && req.Body != nil && req.Body != http.NoBody {
+		requestBody = &bodyWrapper{
+			body:  req.Body,
+			limit: bodyLimit(m.settings.MaxRequestBodySize),
+			onReadingStart: func() {
+				timeline.logEvent("RequestBodyReadingStart", nil)
+			},
+			onReadingDone: func() {
+				timeline.logEvent("RequestBodyReadingDone", nil)
+			},
+			onClose: func(bw *bodyWrapper) {
+				timeline.logEvent("RequestBodyClosed", nil)
+			},
+		}
+		req.Body = requestBody
+	}
+
+	rw := &responseRecorder{
+		ResponseWriter: w,
+		captureBody:    includeBody,
+		limit:          bodyLimit(m.settings.MaxResponseBodySize),
+		onWriteHeader: func(statusCode int) {
+			timeline.logEvent("WroteHeaders", statusCode)
+		},
+		onHijack: func() {
+			timeline.logEvent("Hijacked", nil)
+		},
+	}
+
+	timeline.logEvent("HandlerStart", nil)
+	rec.notify()
+
+	defer func() {
+		recovered := recover()
+		timeline.logEvent("HandlerDone", nil)
+		rec.finish(func(p *RoundTripLog) {
+			if requestBody != nil {
+				p.RequestLog.captureBody(requestBody.content, requestBody.size, requestBody.limit)
+			}
+			if recovered != nil {
+				p.Error = &RequestError{
+					Message: fmt.Sprintf("handler panic: %v", recovered),
+				}
+			}
+			p.ResponseLog = rw.responseLog()
+			p.ResponseLog.Proto = req.Proto
+		})
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+
+	m.next.ServeHTTP(rw, req)
+}
+
+// requestURL restores absolute url of the inbound request.
+func requestURL(req *http.Request) string {
+	if req.URL.IsAbs() {
+		return req.URL.String()
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, req.Host, req.URL.RequestURI())
+}
+
+// responseRecorder implements http.ResponseWriter interface to spy on the
+// response written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	captureBody   bool
+	limit         int64
+	wroteHeader   bool
+	statusCode    int
+	header        http.Header
+	written       int64
+	content       []byte
+	onWriteHeader func(int)
+	onHijack      func()
+}
+
+// WriteHeader records status code and snapshot of headers sent to the client.
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if !rr.wroteHeader {
+		rr.wroteHeader = true
+		rr.statusCode = statusCode
+		rr.header = rr.ResponseWriter.Header().Clone()
+		if rr.onWriteHeader != nil {
+			rr.onWriteHeader(statusCode)
+		}
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records body written by a handler.
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	n, err := rr.ResponseWriter.Write(p)
+	rr.written += int64(n)
+	if rr.captureBody {
+		rr.content = appendLimited(rr.content, p[:n], rr.limit)
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher when underlying writer supports it.
+func (rr *responseRecorder) Flush() {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, e.g. for websockets, when
+// underlying writer supports it.
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rr.ResponseWriter).Hijack()
+	if err == nil && rr.onHijack != nil {
+		rr.onHijack()
+	}
+	return conn, rw, err
+}
+
+// Push implements http.Pusher when underlying writer supports it.
+func (rr *responseRecorder) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rr.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom implements io.ReaderFrom copying through Write, so that the body
+// is still recorded.
+func (rr *responseRecorder) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{rr}, r)
+}
+
+// writerOnly hides ReadFrom of the writer to avoid recursion in io.Copy.
+type writerOnly struct {
+	io.Writer
+}
+
+// Unwrap allows http.ResponseController to access underlying writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+func (rr *responseRecorder) responseLog() *ResponseLog {
+	if !rr.wroteHeader {
+		// handler returned without writing anything, server replies with 200
+		rr.statusCode = http.StatusOK
+		rr.header = rr.ResponseWriter.Header().Clone()
+	}
+	res := &ResponseLog{
+		Status:        fmt.Sprintf("%d %s", rr.statusCode, http.StatusText(rr.statusCode)),
+		StatusCode:    rr.statusCode,
+		Header:        rr.header,
+		ContentLength: rr.written,
+	}
+	if rr.captureBody {
+		res.captureBody(rr.content, rr.written, rr.limit)
+	}
+	return res
+}
@@ -0,0 +1,163 @@
+package witness
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("with body", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("X-Echo", "yes")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}), WithNotifier(notifier), WithBodyCapture(true))
+
+		req := httptest.NewRequest("POST", "/echo?a=1", strings.NewReader("hello"))
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if rw.Body.String() != "hello" {
+			t.Errorf("expected handler response to pass through, got '%v'", rw.Body.String())
+		}
+
+		payload := notifier.payload
+		if payload.Direction != Inbound {
+			t.Errorf("expected direction %v, got %v", Inbound, payload.Direction)
+		}
+		if !payload.Done {
+			t.Error("expected final payload to be reported")
+		}
+		if payload.RequestLog.Url != "http://example.com/echo?a=1" {
+			t.Errorf("unexpected url %v", payload.RequestLog.Url)
+		}
+		if payload.RequestLog.Body != "hello" {
+			t.Errorf("expected request body to be 'hello', got '%v'", payload.RequestLog.Body)
+		}
+		if payload.ResponseLog.StatusCode != http.StatusCreated {
+			t.Errorf("expected status %d, got %d", http.StatusCreated, payload.ResponseLog.StatusCode)
+		}
+		if payload.ResponseLog.Header.Get("X-Echo") != "yes" {
+			t.Error("expected response header to be captured")
+		}
+		if payload.ResponseLog.Body != "hello" || payload.ResponseLog.ContentLength != 5 {
+			t.Errorf("unexpected response body '%v' of length %d", payload.ResponseLog.Body, payload.ResponseLog.ContentLength)
+		}
+	})
+
+	t.Run("body limit", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, r.Body)
+		}), WithNotifier(notifier), WithBodyCapture(true), WithBodyLimit(2, 3))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+
+		req, res := notifier.payload.RequestLog, notifier.payload.ResponseLog
+		if req.Body != "he" || req.BodySize != 5 || !req.BodyTruncated {
+			t.Errorf("expected request body to be truncated, got %+v", req)
+		}
+		if res.Body != "hel" || res.BodySize != 5 || !res.BodyTruncated {
+			t.Errorf("expected response body to be truncated, got %+v", res)
+		}
+	})
+
+	t.Run("without body", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "ok")
+		}), WithNotifier(notifier))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		payload := notifier.payload
+		if payload.ResponseLog.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200, got %d", payload.ResponseLog.StatusCode)
+		}
+		if payload.ResponseLog.Body != "" {
+			t.Errorf("expected body not to be captured, got '%v'", payload.ResponseLog.Body)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}), WithNotifier(notifier))
+
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic to be propagated")
+			}
+			if notifier.payload.Error == nil {
+				t.Error("expected error to be reported")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+
+	t.Run("outbound calls carry parent id", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer upstream.Close()
+
+		inbound := &fakeNotifier{}
+		outbound := &fakeNotifier{}
+		client := &http.Client{Transport: &Transport{Notifier: outbound}}
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL, nil)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+		}), WithNotifier(inbound))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		if outbound.payload.ParentID == "" || outbound.payload.ParentID != inbound.payload.ID {
+			t.Errorf("expected parent id %v, got %v", inbound.payload.ID, outbound.payload.ParentID)
+		}
+		if inbound.payload.ParentID != "" {
+			t.Errorf("expected inbound round trip without parent, got %v", inbound.payload.ParentID)
+		}
+	})
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	notifier := &chanNotifier{make(chan RoundTripLog, 10)}
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		rw.Flush()
+	}), WithNotifier(notifier))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("expected hijacked connection to respond, got %v", res.Status)
+	}
+	for rtl := range notifier.ch {
+		if rtl.Done {
+			events := serializeOrDie(rtl.Timeline.Events)
+			if !strings.Contains(string(events), "Hijacked") {
+				t.Errorf("expected hijacking to be recorded, got %s", events)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package witness
+
+import (
+	"context"
+	"log"
+)
+
+// Sink is a notifier receiving round trips accepted by its Filter.
+type Sink struct {
+	Notifier Notifier
+	// Filter returns true for round trips to be delivered to the sink, all
+	// round trips are delivered when nil.
+	Filter func(RoundTripLog) bool
+	// QueueSize is the number of round trips waiting for delivery to the
+	// sink, DefaultQueueSize when zero.
+	QueueSize int
+	// Overflow policy applied when the sink can not keep up.
+	Overflow OverflowPolicy
+}
+
+// MultiNotifier dispatches round trips to several sinks. Every sink is served
+// by its own goroutine, so a slow or panicking sink affects neither other
+// sinks nor the instrumented requests.
+type MultiNotifier struct {
+	sinks []*sinkWorker
+}
+
+type sinkWorker struct {
+	Sink
+	async *AsyncNotifier
+}
+
+// NewMultiNotifier creates notifier dispatching to sinks.
+func NewMultiNotifier(sinks ...Sink) *MultiNotifier {
+	m := &MultiNotifier{}
+	for _, s := range sinks {
+		size := s.QueueSize
+		if size == 0 {
+			size = DefaultQueueSize
+		}
+		m.sinks = append(m.sinks, &sinkWorker{
+			Sink:  s,
+			async: NewAsyncNotifier(s.Notifier, size, s.Overflow),
+		})
+	}
+	return m
+}
+
+// Init initialises sinks one by one, it blocks as long as any of them does.
+func (m *MultiNotifier) Init(ctx context.Context) {
+	for _, w := range m.sinks {
+		w.Notifier.Init(ctx)
+	}
+}
+
+// Notify queues round trip for delivery to every sink accepting it.
+func (m *MultiNotifier) Notify(rtl RoundTripLog) {
+	for _, w := range m.sinks {
+		if w.accepts(rtl) {
+			w.async.Notify(rtl)
+		}
+	}
+}
+
+// Stats reports delivery counters of every sink in order of NewMultiNotifier arguments.
+func (m *MultiNotifier) Stats() []QueueStats {
+	stats := make([]QueueStats, 0, len(m.sinks))
+	for _, w := range m.sinks {
+		stats = append(stats, w.async.Stats())
+	}
+	return stats
+}
+
+// Close waits until queued round trips are delivered to all sinks.
+func (m *MultiNotifier) Close() {
+	for _, w := range m.sinks {
+		w.async.Close()
+	}
+}
+
+func (w *sinkWorker) accepts(rtl RoundTripLog) (accepted bool) {
+	if w.Filter == nil {
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("witness: sink filter panic: %v", r)
+			accepted = false
+		}
+	}()
+	return w.Filter(rtl)
+}
+
+// OnlyDone is a sink filter accepting completed round trips.
+func OnlyDone(rtl RoundTripLog) bool {
+	return rtl.Done
+}
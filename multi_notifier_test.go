@@ -0,0 +1,69 @@
+package witness
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type chanNotifier struct {
+	ch chan RoundTripLog
+}
+
+func (n *chanNotifier) Init(ctx context.Context) {}
+
+func (n *chanNotifier) Notify(rtl RoundTripLog) {
+	n.ch <- rtl
+}
+
+type panickingNotifier struct{}
+
+func (n *panickingNotifier) Init(ctx context.Context) {}
+
+func (n *panickingNotifier) Notify(rtl RoundTripLog) {
+	panic("boom")
+}
+
+func TestMultiNotifier(t *testing.T) {
+	all := &chanNotifier{make(chan RoundTripLog, 10)}
+	done := &chanNotifier{make(chan RoundTripLog, 10)}
+	stuck := &chanNotifier{make(chan RoundTripLog)}
+
+	m := NewMultiNotifier(
+		Sink{Notifier: &panickingNotifier{}},
+		Sink{Notifier: stuck},
+		Sink{Notifier: all},
+		Sink{Notifier: done, Filter: OnlyDone},
+		Sink{Notifier: all, Filter: func(RoundTripLog) bool { panic("filter") }},
+	)
+	m.Init(context.Background())
+
+	m.Notify(RoundTripLog{ID: "1"})
+	m.Notify(RoundTripLog{ID: "1", Done: true})
+
+	for _, id := range []string{"1", "1"} {
+		select {
+		case rtl := <-all.ch:
+			if rtl.ID != id {
+				t.Errorf("expected %v, got %v", id, rtl.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected delivery despite stuck and panicking sinks")
+		}
+	}
+
+	select {
+	case rtl := <-done.ch:
+		if !rtl.Done {
+			t.Error("expected filter to skip incomplete round trip")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected completed round trip to be delivered")
+	}
+
+	select {
+	case rtl := <-all.ch:
+		t.Errorf("unexpected delivery of %+v", rtl)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
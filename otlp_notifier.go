@@ -0,0 +1,287 @@
+package witness
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of OTLPNotifier used when its fields are not set.
+const (
+	DefaultOTLPServiceName  = "witness"
+	DefaultOTLPBatchTimeout = 5 * time.Second
+	DefaultOTLPMaxQueueSize = 2048
+)
+
+// OTLPNotifier exports completed round trips as OpenTelemetry spans using
+// OTLP/HTTP protocol with JSON encoding.
+type OTLPNotifier struct {
+	// Endpoint is the url of the collector, e.g. http://localhost:4318/v1/traces
+	Endpoint string
+	// ServiceName is reported as service.name resource attribute,
+	// DefaultOTLPServiceName when empty.
+	ServiceName string
+	// Header is sent with every export request, e.g. for authentication.
+	Header http.Header
+	// Client used to export spans, http.DefaultClient when nil.
+	Client *http.Client
+	// BatchTimeout is the interval between exports, DefaultOTLPBatchTimeout
+	// when not positive.
+	BatchTimeout time.Duration
+	// MaxQueueSize limits number of spans waiting for export, extra spans are
+	// dropped. DefaultOTLPMaxQueueSize is used when it is not positive.
+	MaxQueueSize int
+
+	mu      sync.Mutex
+	pending []otlpSpan
+}
+
+// NewOTLPNotifier creates notifier exporting spans to the collector endpoint.
+func NewOTLPNotifier(endpoint string) *OTLPNotifier {
+	return &OTLPNotifier{
+		Endpoint:     endpoint,
+		ServiceName:  DefaultOTLPServiceName,
+		BatchTimeout: DefaultOTLPBatchTimeout,
+		MaxQueueSize: DefaultOTLPMaxQueueSize,
+	}
+}
+
+// Init starts periodic export, pending spans are flushed when ctx is done.
+func (o *OTLPNotifier) Init(ctx context.Context) {
+	interval := o.BatchTimeout
+	if interval <= 0 {
+		interval = DefaultOTLPBatchTimeout
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.flushOrLog()
+			case <-ctx.Done():
+				o.flushOrLog()
+				return
+			}
+		}
+	}()
+}
+
+// Notify queues completed round trip for export, intermediate updates are ignored.
+func (o *OTLPNotifier) Notify(rtl RoundTripLog) {
+	if !rtl.Done {
+		return
+	}
+	span := toOTLPSpan(rtl)
+	limit := o.MaxQueueSize
+	if limit <= 0 {
+		limit = DefaultOTLPMaxQueueSize
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending) >= limit {
+		return
+	}
+	o.pending = append(o.pending, span)
+}
+
+func (o *OTLPNotifier) flushOrLog() {
+	if err := o.Flush(); err != nil {
+		log.Println("witness: otlp export failed:", err)
+	}
+}
+
+// Flush exports all pending spans immediately.
+func (o *OTLPNotifier) Flush() error {
+	o.mu.Lock()
+	spans := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+	serviceName := o.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultOTLPServiceName
+	}
+
+	body, err := json.Marshal(otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{stringAttribute("service.name", serviceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/1602/witness"},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range o.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", res.Status)
+	}
+	return nil
+}
+
+// OTLP span kinds and status codes.
+const (
+	otlpSpanKindServer = 2
+	otlpSpanKindClient = 3
+
+	otlpStatusError = 2
+)
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Events            []otlpEvent     `json:"events"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{key, otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{key, otlpValue{IntValue: &s}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// toOTLPSpan converts round trip log to span, timeline events become span events.
+func toOTLPSpan(rtl RoundTripLog) otlpSpan {
+	span := otlpSpan{
+		TraceID:      rtl.TraceID,
+		SpanID:       rtl.SpanID,
+		ParentSpanID: rtl.ParentSpanID,
+		Kind:         otlpSpanKindClient,
+		Attributes:   []otlpAttribute{stringAttribute("witness.id", rtl.ID)},
+		Events:       []otlpEvent{},
+	}
+	if rtl.Direction == Inbound {
+		span.Kind = otlpSpanKindServer
+	}
+	if rtl.ParentID != "" {
+		span.Attributes = append(span.Attributes, stringAttribute("witness.parent_id", rtl.ParentID))
+	}
+
+	if req := rtl.RequestLog; req != nil {
+		span.Name = req.Method
+		span.Attributes = append(span.Attributes,
+			stringAttribute("http.request.method", req.Method),
+			stringAttribute("url.full", req.Url),
+		)
+	}
+
+	if res := rtl.ResponseLog; res != nil {
+		span.Attributes = append(span.Attributes, intAttribute("http.response.status_code", int64(res.StatusCode)))
+		if res.StatusCode >= 500 || (rtl.Direction != Inbound && res.StatusCode >= 400) {
+			span.Status.Code = otlpStatusError
+		}
+	}
+
+	if rtl.Error != nil {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: rtl.Error.Message}
+	}
+
+	if tl := rtl.Timeline; tl != nil {
+		span.StartTimeUnixNano = unixNano(tl.StartedAt)
+		span.EndTimeUnixNano = unixNano(tl.StartedAt.Add(time.Duration(rtl.DurationNano)))
+		for _, e := range tl.Events {
+			event := otlpEvent{
+				TimeUnixNano: unixNano(tl.StartedAt.Add(time.Duration(e.Delay))),
+				Name:         e.Name,
+			}
+			if e.Payload != nil {
+				if payload, err := json.Marshal(e.Payload); err == nil {
+					event.Attributes = []otlpAttribute{stringAttribute("witness.payload", string(payload))}
+				}
+			}
+			span.Events = append(span.Events, event)
+		}
+	}
+
+	return span
+}
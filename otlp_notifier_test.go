@@ -0,0 +1,100 @@
+package witness
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOTLPNotifier(t *testing.T) {
+	received := make(chan otlpTraces, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %v", r.Header.Get("Content-Type"))
+		}
+		var traces otlpTraces
+		if err := json.NewDecoder(r.Body).Decode(&traces); err != nil {
+			t.Error(err)
+		}
+		received <- traces
+	}))
+	defer collector.Close()
+
+	startedAt := time.Now()
+	n := NewOTLPNotifier(collector.URL + "/v1/traces")
+	n.Notify(RoundTripLog{
+		ID:         "not done",
+		RequestLog: &RequestLog{Method: "GET"},
+	})
+	n.Notify(RoundTripLog{
+		ID:           "1",
+		Direction:    Outbound,
+		TraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:       "00f067aa0ba902b7",
+		RequestLog:   &RequestLog{Method: "GET", Url: "http://example.com"},
+		ResponseLog:  &ResponseLog{StatusCode: 503},
+		Timeline:     &Timeline{StartedAt: startedAt, Events: []Event{{Name: "DNSStart", Delay: 10}, {Name: "GotFirstResponseByte", Delay: 20}}},
+		DurationNano: 30,
+		Done:         true,
+	})
+
+	if err := n.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	traces := <-received
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("expected only completed round trip to be exported, got %d spans", len(spans))
+	}
+	span := spans[0]
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span ids %v %v", span.TraceID, span.SpanID)
+	}
+	if span.Kind != otlpSpanKindClient || span.Name != "GET" {
+		t.Errorf("unexpected span kind %d or name %v", span.Kind, span.Name)
+	}
+	if span.Status.Code != otlpStatusError {
+		t.Error("expected 5xx response to mark span as failed")
+	}
+	if span.EndTimeUnixNano != unixNano(startedAt.Add(30)) {
+		t.Errorf("unexpected end time %v", span.EndTimeUnixNano)
+	}
+	if len(span.Events) != 2 || span.Events[1].Name != "GotFirstResponseByte" || span.Events[1].TimeUnixNano != unixNano(startedAt.Add(20)) {
+		t.Errorf("unexpected span events %+v", span.Events)
+	}
+
+	t.Run("flushes on context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		n.Init(ctx)
+		n.Notify(RoundTripLog{Done: true, RequestLog: &RequestLog{Method: "POST"}})
+		cancel()
+		select {
+		case traces := <-received:
+			if traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Name != "POST" {
+				t.Error("expected pending span to be exported")
+			}
+		case <-time.After(time.Second):
+			t.Error("expected export on context cancellation")
+		}
+	})
+	t.Run("zero value", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		n := &OTLPNotifier{Endpoint: collector.URL + "/v1/traces"}
+		n.Init(ctx)
+		n.Notify(RoundTripLog{Done: true, RequestLog: &RequestLog{Method: "PUT"}})
+		cancel()
+		select {
+		case traces := <-received:
+			attr := traces.ResourceSpans[0].Resource.Attributes[0]
+			if attr.Value.StringValue == nil || *attr.Value.StringValue != DefaultOTLPServiceName {
+				t.Errorf("expected default service name, got %+v", attr)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected export on context cancellation")
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package witness
+
+import "sync"
+
+// OverflowPolicy decides what happens to a round trip when delivery queue is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest evicts the oldest queued item to make room for the new one.
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the new item.
+	DropNewest
+	// Block waits until there is room in the queue, stalling the caller.
+	Block
+)
+
+// QueueStats reports counters of a delivery queue.
+type QueueStats struct {
+	// Enqueued is the number of items accepted by the queue.
+	Enqueued uint64 `json:"enqueued"`
+	// Dropped is the number of items discarded due to overflow.
+	Dropped uint64 `json:"dropped"`
+	// Pending is the number of items waiting for delivery.
+	Pending int `json:"pending"`
+}
+
+// queue is a bounded FIFO queue with configurable overflow policy.
+type queue[T any] struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []T
+	head     int
+	size     int
+	policy   OverflowPolicy
+	closed   bool
+	enqueued uint64
+	dropped  uint64
+}
+
+func newQueue[T any](capacity int, policy OverflowPolicy) *queue[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &queue[T]{
+		items:  make([]T, capacity),
+		policy: policy,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds item to the tail of the queue applying overflow policy, it
+// returns false when item was dropped.
+func (q *queue[T]) push(item T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.size == len(q.items) && q.policy == Block && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		q.dropped++
+		return false
+	}
+	if q.size == len(q.items) {
+		q.dropped++
+		if q.policy == DropNewest {
+			return false
+		}
+		var zero T
+		q.items[q.head] = zero
+		q.head = (q.head + 1) % len(q.items)
+		q.size--
+	}
+	q.items[(q.head+q.size)%len(q.items)] = item
+	q.size++
+	q.enqueued++
+	q.notEmpty.Signal()
+	return true
+}
+
+// pop removes item from the head of the queue waiting for one to appear,
+// ok is false when queue is closed and drained.
+func (q *queue[T]) pop() (item T, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.size == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.size == 0 {
+		return item, false
+	}
+	item = q.items[q.head]
+	var zero T
+	q.items[q.head] = zero
+	q.head = (q.head + 1) % len(q.items)
+	q.size--
+	q.notFull.Signal()
+	return item, true
+}
+
+// close stops accepting new items, queued ones could still be popped.
+func (q *queue[T]) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *queue[T]) stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Enqueued: q.enqueued,
+		Dropped:  q.dropped,
+		Pending:  q.size,
+	}
+}
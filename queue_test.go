@@ -0,0 +1,71 @@
+package witness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("drop oldest", func(t *testing.T) {
+		q := newQueue[int](2, DropOldest)
+		for i := 1; i <= 3; i++ {
+			q.push(i)
+		}
+		if stats := q.stats(); stats.Dropped != 1 || stats.Enqueued != 3 || stats.Pending != 2 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+		for _, expected := range []int{2, 3} {
+			if item, _ := q.pop(); item != expected {
+				t.Errorf("expected %d, got %d", expected, item)
+			}
+		}
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		q := newQueue[int](2, DropNewest)
+		for i := 1; i <= 3; i++ {
+			q.push(i)
+		}
+		if stats := q.stats(); stats.Dropped != 1 || stats.Enqueued != 2 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+		for _, expected := range []int{1, 2} {
+			if item, _ := q.pop(); item != expected {
+				t.Errorf("expected %d, got %d", expected, item)
+			}
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		q := newQueue[int](1, Block)
+		q.push(1)
+		pushed := make(chan bool)
+		go func() {
+			pushed <- q.push(2)
+		}()
+		select {
+		case <-pushed:
+			t.Fatal("expected push to block while queue is full")
+		case <-time.After(10 * time.Millisecond):
+		}
+		q.pop()
+		if !<-pushed {
+			t.Error("expected blocked push to succeed once there is room")
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		q := newQueue[int](2, Block)
+		q.push(1)
+		q.close()
+		if q.push(2) {
+			t.Error("expected closed queue to reject items")
+		}
+		if item, ok := q.pop(); !ok || item != 1 {
+			t.Error("expected queued item to be drained after close")
+		}
+		if _, ok := q.pop(); ok {
+			t.Error("expected drained closed queue to report end")
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package witness
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recorder guards round trip log updated from several goroutines (httptrace
+// callbacks, body wrappers, the caller) and hands notifier deep snapshots of
+// it, so that notifiers never share memory with the log being recorded.
+// Secrets are masked in snapshots, the log itself is kept intact.
+type recorder struct {
+	mu        sync.Mutex
+	notifier  Notifier
+	redactor  *Redactor
+	payload   *RoundTripLog
+	startedAt time.Time
+	finished  bool
+}
+
+func newRecorder(n Notifier, redactor *Redactor, payload *RoundTripLog) *recorder {
+	return &recorder{
+		notifier:  n,
+		redactor:  redactor,
+		payload:   payload,
+		startedAt: payload.Timeline.StartedAt,
+	}
+}
+
+// update modifies round trip log under lock.
+func (r *recorder) update(fn func(*RoundTripLog)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.payload)
+}
+
+// notify sends snapshot of the log unless the round trip is already finished.
+// Notifier is called under lock to preserve order of snapshots.
+func (r *recorder) notify() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.notifier.Notify(r.report())
+}
+
+// finish marks round trip as done applying final updates and sends the last
+// snapshot, subsequent calls are ignored.
+func (r *recorder) finish(fn func(*RoundTripLog)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.finished = true
+	if fn != nil {
+		fn(r.payload)
+	}
+	duration := time.Now().Sub(r.startedAt)
+	r.payload.Done = true
+	r.payload.Duration = roundDuration(duration, 1).String()
+	r.payload.DurationNano = duration.Nanoseconds()
+	r.notifier.Notify(r.report())
+}
+
+// report makes redacted snapshot of the log for the notifier.
+func (r *recorder) report() RoundTripLog {
+	s := r.payload.snapshot()
+	r.redactor.redact(&s)
+	return s
+}
+
+// snapshot returns deep copy of the log.
+func (rtl *RoundTripLog) snapshot() RoundTripLog {
+	s := *rtl
+	if rtl.RequestLog != nil {
+		req := *rtl.RequestLog
+		req.Header = rtl.RequestLog.Header.Clone()
+		req.Query = cloneValues(rtl.RequestLog.Query)
+		s.RequestLog = &req
+	}
+	if rtl.ResponseLog != nil {
+		res := *rtl.ResponseLog
+		res.Header = rtl.ResponseLog.Header.Clone()
+		s.ResponseLog = &res
+	}
+	if rtl.Error != nil {
+		e := *rtl.Error
+		s.Error = &e
+	}
+	if rtl.Timeline != nil {
+		s.Timeline = rtl.Timeline.snapshot()
+	}
+	return s
+}
+
+func cloneValues(values map[string][]string) map[string][]string {
+	return map[string][]string(http.Header(values).Clone())
+}
@@ -0,0 +1,260 @@
+package witness
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Redacted replaces masked values.
+const Redacted = "[REDACTED]"
+
+// Redactor masks secrets in round trip logs before they are passed to a
+// Notifier. Names are matched case-insensitively.
+type Redactor struct {
+	// Headers are names of request and response headers to mask.
+	Headers []string
+	// QueryParams are names of query parameters to mask, they are masked in
+	// url encoded form bodies too.
+	QueryParams []string
+	// BodyPaths are dot separated paths of values to mask in JSON bodies,
+	// "*" matches any key or index, e.g. "user.password" or "items.*.token".
+	BodyPaths []string
+	// BodyPatterns are masked wherever they match in bodies.
+	BodyPatterns []*regexp.Regexp
+}
+
+// DefaultRedactor is used unless instrumentation is configured with
+// WithRedactor. It masks credentials commonly sent in headers, query and
+// OAuth token responses.
+var DefaultRedactor = &Redactor{
+	Headers: []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"X-Api-Key",
+		"Api-Key",
+		"X-Auth-Token",
+		"X-Amz-Security-Token",
+	},
+	QueryParams: []string{
+		"access_token",
+		"api_key",
+		"apikey",
+		"client_secret",
+		"password",
+		"token",
+	},
+	BodyPaths: []string{
+		"access_token",
+		"refresh_token",
+		"id_token",
+		"client_secret",
+		"password",
+	},
+}
+
+// redact masks secrets in snapshot of round trip log.
+func (r *Redactor) redact(rtl *RoundTripLog) {
+	if req := rtl.RequestLog; req != nil {
+		original := req.Url
+		req.Url = r.redactURL(req.Url)
+		if req.Url != original && rtl.Error != nil {
+			// url errors quote the url
+			rtl.Error.Message = strings.ReplaceAll(rtl.Error.Message, original, req.Url)
+			rtl.Error.Details = nil
+		}
+		for name, values := range req.Query {
+			if matchName(r.QueryParams, name) {
+				req.Query[name] = masked(values)
+			}
+		}
+		r.redactHeader(req.Header)
+		req.Body = r.redactBody(req.Body, req.Header)
+	}
+	if res := rtl.ResponseLog; res != nil {
+		r.redactHeader(res.Header)
+		res.Body = r.redactBody(res.Body, res.Header)
+	}
+	if rtl.Timeline != nil {
+		r.redactEvents(rtl.Timeline.Events)
+	}
+}
+
+// redactEvents masks headers reported by trace events, payloads are shared
+// with the recorded timeline, so they are replaced rather than modified.
+func (r *Redactor) redactEvents(events []Event) {
+	for i, e := range events {
+		switch payload := e.Payload.(type) {
+		case headerField:
+			if matchName(r.Headers, payload.Key) {
+				events[i].Payload = headerField{payload.Key, masked(payload.Value)}
+			}
+		case informationalResponse:
+			header := http.Header(payload.Header).Clone()
+			r.redactHeader(header)
+			events[i].Payload = informationalResponse{payload.Code, textproto.MIMEHeader(header)}
+		}
+	}
+}
+
+func (r *Redactor) redactHeader(header http.Header) {
+	for name, values := range header {
+		if matchName(r.Headers, name) {
+			header[name] = masked(values)
+		}
+	}
+}
+
+// redactURL masks password and query parameters keeping the rest of url as is.
+func (r *Redactor) redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := r.redactQuery(u.RawQuery)
+	if _, ok := u.User.Password(); !ok && query == u.RawQuery {
+		return rawURL
+	}
+	u.RawQuery = query
+	return u.Redacted()
+}
+
+// redactQuery masks values of url encoded parameters preserving their order
+// and encoding.
+func (r *Redactor) redactQuery(query string) string {
+	if query == "" || len(r.QueryParams) == 0 {
+		return query
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if matchName(r.QueryParams, name) {
+			pairs[i] = key + "=" + Redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// redactBody masks JSON paths or form parameters depending on content type,
+// then patterns.
+func (r *Redactor) redactBody(body string, header http.Header) string {
+	if body == "" {
+		return body
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		body = r.redactQuery(body)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "":
+		body = r.redactJSON(body)
+	}
+	for _, re := range r.BodyPatterns {
+		body = re.ReplaceAllString(body, Redacted)
+	}
+	return body
+}
+
+// redactJSON masks values at BodyPaths, body is returned as is when nothing
+// is masked. Bodies which could not be decoded, e.g. truncated ones, are
+// masked by keys.
+func (r *Redactor) redactJSON(body string) string {
+	if len(r.BodyPaths) == 0 {
+		return body
+	}
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return r.redactJSONKeys(body)
+	}
+	changed := false
+	for _, path := range r.BodyPaths {
+		if redactPath(doc, strings.Split(path, ".")) {
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// redactJSONKeys masks string values of keys BodyPaths end with wherever
+// they appear in the body, including value cut at the end of it.
+func (r *Redactor) redactJSONKeys(body string) string {
+	var keys []string
+	for _, path := range r.BodyPaths {
+		key := path[strings.LastIndex(path, ".")+1:]
+		if key != "*" {
+			keys = append(keys, regexp.QuoteMeta(key))
+		}
+	}
+	if len(keys) == 0 {
+		return body
+	}
+	re := regexp.MustCompile(`(?i)("(?:` + strings.Join(keys, "|") + `)"\s*:\s*")(?:[^"\\]|\\.)*(?:\\$)?`)
+	return re.ReplaceAllString(body, "${1}"+Redacted)
+}
+
+// redactPath masks values of decoded JSON document at path.
+func redactPath(node any, path []string) bool {
+	key, rest := path[0], path[1:]
+	changed := false
+	visit := func(name string, child any, set func()) {
+		if key != "*" && !strings.EqualFold(key, name) {
+			return
+		}
+		if len(rest) == 0 {
+			set()
+			changed = true
+		} else if redactPath(child, rest) {
+			changed = true
+		}
+	}
+	switch node := node.(type) {
+	case map[string]any:
+		for name, child := range node {
+			visit(name, child, func() { node[name] = Redacted })
+		}
+	case []any:
+		for i, child := range node {
+			visit(strconv.Itoa(i), child, func() { node[i] = Redacted })
+		}
+	}
+	return changed
+}
+
+func matchName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func masked(values []string) []string {
+	m := make([]string, len(values))
+	for i := range m {
+		m[i] = Redacted
+	}
+	return m
+}
@@ -0,0 +1,138 @@
+package witness
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"slices"
+)
+
+const (
+	// sseTokenParam is the query parameter carrying access token.
+	sseTokenParam = "token"
+	// sseTokenCookie remembers access token for requests made by the UI.
+	sseTokenCookie = "witness_token"
+)
+
+// WithSSEToken sets token required to access the UI and events stream
+// instead of the random one generated by default. Empty token disables
+// token authentication.
+func WithSSEToken(token string) SSEOption {
+	return func(t *sse) {
+		t.token = token
+		t.tokenSet = true
+	}
+}
+
+// WithSSEAllowedOrigins sets origins of web pages allowed to read the events
+// stream and HAR export. By default only the UI served by witness itself has
+// access. "*" allows any origin to make requests without credentials, i.e.
+// with token in the query, only listed origins may send cookies or basic auth.
+func WithSSEAllowedOrigins(origins ...string) SSEOption {
+	return func(t *sse) {
+		t.allowedOrigins = origins
+	}
+}
+
+// WithSSEBasicAuth requires clients to authenticate with user and password,
+// e.g. when witness is shared on a staging host.
+func WithSSEBasicAuth(user, password string) SSEOption {
+	return func(t *sse) {
+		t.basicUser = user
+		t.basicPassword = password
+	}
+}
+
+// newSSEToken generates random access token.
+func newSSEToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Token returns token required to access the UI, it is empty when token
+// authentication is disabled. Random token is generated on first use.
+func (t *sse) Token() string {
+	t.tokenOnce.Do(func() {
+		if !t.tokenSet {
+			t.token = newSSEToken()
+		}
+	})
+	return t.token
+}
+
+// protect wraps handler served under cookiePath with CORS and authentication.
+// Token is accepted as query parameter and then kept in cookie, so that
+// resources loaded by the UI do not need it.
+func (t *sse) protect(h http.Handler, cookiePath string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		allowed := t.allowOrigin(rw, req)
+		if allowed && req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			// preflight of cross-origin request, e.g. with basic auth
+			rw.Header().Set("Access-Control-Allow-Methods", "GET")
+			rw.Header().Set("Access-Control-Allow-Headers", "Authorization, Last-Event-ID")
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if t.basicUser != "" || t.basicPassword != "" {
+			user, password, ok := req.BasicAuth()
+			if !ok || !secretEqual(user, t.basicUser) || !secretEqual(password, t.basicPassword) {
+				rw.Header().Set("WWW-Authenticate", `Basic realm="witness"`)
+				http.Error(rw, "witness: unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if expected := t.Token(); expected != "" {
+			token := req.URL.Query().Get(sseTokenParam)
+			if token == "" {
+				if c, err := req.Cookie(sseTokenCookie); err == nil {
+					token = c.Value
+				}
+			} else if secretEqual(token, expected) {
+				http.SetCookie(rw, &http.Cookie{
+					Name:     sseTokenCookie,
+					Value:    token,
+					Path:     cookiePath,
+					HttpOnly: true,
+					Secure:   req.TLS != nil,
+					SameSite: http.SameSiteStrictMode,
+				})
+			}
+			if !secretEqual(token, expected) {
+				http.Error(rw, "witness: missing or invalid token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// allowOrigin sets CORS headers when origin of the request is allowed and
+// reports whether it is.
+func (t *sse) allowOrigin(rw http.ResponseWriter, req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	rw.Header().Add("Vary", "Origin")
+	switch {
+	case slices.Contains(t.allowedOrigins, origin):
+		rw.Header().Set("Access-Control-Allow-Origin", origin)
+		rw.Header().Set("Access-Control-Allow-Credentials", "true")
+	case slices.Contains(t.allowedOrigins, "*"):
+		rw.Header().Set("Access-Control-Allow-Origin", "*")
+	default:
+		return false
+	}
+	return true
+}
+
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
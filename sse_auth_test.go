@@ -0,0 +1,106 @@
+package witness
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	serve := func(opts ...SSEOption) (*sse, *httptest.Server) {
+		tr := NewSSENotifier(append([]SSEOption{WithoutSSEServer()}, opts...)...)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		tr.Start(ctx)
+		mux := http.NewServeMux()
+		mux.Handle("/debug/witness/", tr.Handler("/debug/witness"))
+		mux.Handle("/debug/witness", tr.Handler("/debug/witness"))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return tr, server
+	}
+	get := func(client *http.Client, url string, header http.Header) *http.Response {
+		req, _ := http.NewRequest("GET", url, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("token", func(t *testing.T) {
+		tr, server := serve()
+		if len(tr.Token()) != 32 {
+			t.Errorf("expected random token to be generated, got %q", tr.Token())
+		}
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+
+		if res := get(client, server.URL+"/debug/witness/", nil); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected request without token to be rejected, got %v", res.Status)
+		}
+		if res := get(client, server.URL+"/debug/witness/?token=wrong", nil); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected request with wrong token to be rejected, got %v", res.Status)
+		}
+		// redirect to the mount point keeps the token
+		if res := get(client, server.URL+"/debug/witness?token="+tr.Token(), nil); res.StatusCode != http.StatusOK {
+			t.Errorf("expected request with token to be served, got %v", res.Status)
+		}
+		// token is remembered in cookie
+		if res := get(client, server.URL+"/debug/witness/export.har", nil); res.StatusCode != http.StatusOK {
+			t.Errorf("expected request with cookie to be served, got %v", res.Status)
+		}
+	})
+
+	t.Run("cors", func(t *testing.T) {
+		_, server := serve(WithSSEToken(""), WithSSEAllowedOrigins("http://allowed.test"))
+		header := http.Header{"Origin": {"http://allowed.test"}}
+		res := get(http.DefaultClient, server.URL+"/debug/witness/export.har", header)
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != "http://allowed.test" {
+			t.Errorf("expected allowed origin, got %q", got)
+		}
+		header = http.Header{"Origin": {"http://evil.test"}}
+		res = get(http.DefaultClient, server.URL+"/debug/witness/export.har", header)
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("expected other origins not to be allowed, got %q", got)
+		}
+
+		_, server = serve(WithSSEToken(""), WithSSEAllowedOrigins("*", "http://allowed.test"))
+		res = get(http.DefaultClient, server.URL+"/debug/witness/export.har", header)
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("expected any origin to be allowed, got %q", got)
+		}
+		if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("expected credentials not to be allowed for any origin, got %q", got)
+		}
+		header = http.Header{"Origin": {"http://allowed.test"}}
+		res = get(http.DefaultClient, server.URL+"/debug/witness/export.har", header)
+		if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("expected credentials to be allowed for listed origin, got %q", got)
+		}
+	})
+
+	t.Run("basic auth", func(t *testing.T) {
+		_, server := serve(WithSSEToken(""), WithSSEBasicAuth("user", "secret"))
+		res := get(http.DefaultClient, server.URL+"/debug/witness/", nil)
+		if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("expected credentials to be requested, got %v", res.Status)
+		}
+		req, _ := http.NewRequest("GET", server.URL+"/debug/witness/", nil)
+		req.SetBasicAuth("user", "secret")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected authenticated request to be served, got %v", res.Status)
+		}
+	})
+}
@@ -2,31 +2,233 @@ package witness
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type sse struct {
-	distributor          chan []byte
-	openingClients       chan chan []byte
-	connectedClients     map[chan []byte]bool
-	closingClients       chan chan []byte
-	firstClient          chan bool
-	firstClientConnected bool
-	ctx                  context.Context
-	startServer          func()
+	distributor      chan sseEvent
+	openingClients   chan *sseClient
+	connectedClients map[*sseClient]bool
+	closingClients   chan *sseClient
+	clientsMu        sync.Mutex
+	clientsSeen      int
+	enoughClients    chan struct{}
+	waitClients      int
+	waitTimeout      time.Duration
+	historySize      int
+	clientBuffer     int
+	maxLag           int
+	spillThreshold   int
+	bodies           *bodyStore
+	heartbeat        time.Duration
+	startServer      func() error
+	addr             string
+	listener         net.Listener
+	server           *http.Server
+	url              string
+	token            string
+	tokenSet         bool
+	tokenOnce        sync.Once
+	allowedOrigins   []string
+	basicUser        string
+	basicPassword    string
+	tlsCertFile      string
+	tlsKeyFile       string
+	tlsSelfSigned    bool
+	fingerprint      string
+	archive          *harArchive
+	replayMu         sync.Mutex
+	replay           []sseEvent
+	queue            *queue[RoundTripLog]
+	queueSize        int
+	overflow         OverflowPolicy
+	started          atomic.Bool
+	startedAt        time.Time
+	epoch            string
+	forwarded        chan struct{}
+	stopping         chan struct{}
+	routerDone       chan struct{}
+	shutdownOnce     sync.Once
+	shutdownErr      error
 }
 
+// SSEOption configures notifier created by NewSSENotifier.
+type SSEOption func(*sse)
+
+// DefaultSSEAddr is the address the streaming server listens on by default.
+const DefaultSSEAddr = "localhost:8989"
+
+// WithSSEAddr sets address of the streaming server, use port 0 to pick any
+// free port and URL to find out which one was chosen.
+func WithSSEAddr(addr string) SSEOption {
+	return func(t *sse) {
+		t.addr = addr
+	}
+}
+
+// WithSSEListener makes the streaming server accept connections on l instead
+// of listening on the address.
+func WithSSEListener(l net.Listener) SSEOption {
+	return func(t *sse) {
+		t.listener = l
+	}
+}
+
+// WithoutSSEServer disables the streaming server, use Handler to serve the
+// UI from your own server.
+func WithoutSSEServer() SSEOption {
+	return func(t *sse) {
+		t.startServer = func() error {
+			return nil
+		}
+	}
+}
+
+// WithSSEWaitForClients makes Init wait until n clients connect, or until
+// timeout passes when it is not zero. Init does not wait when n is zero.
+// Init waits for one client by default.
+func WithSSEWaitForClients(n int, timeout time.Duration) SSEOption {
+	return func(t *sse) {
+		t.waitClients = n
+		t.waitTimeout = timeout
+	}
+}
+
+// WithSSEHistory sets number of recent events kept in memory to be sent to
+// clients connecting later, including events happened before the first
+// client connected. Reconnecting clients only receive events they missed.
+func WithSSEHistory(n int) SSEOption {
+	return func(t *sse) {
+		t.historySize = n
+	}
+}
+
+// WithSSEQueue sets size and overflow policy of the queue buffering events
+// until they are sent to connected clients.
+func WithSSEQueue(size int, policy OverflowPolicy) SSEOption {
+	return func(t *sse) {
+		t.queueSize = size
+		t.overflow = policy
+	}
+}
+
+// DefaultSSEClientBuffer is the number of events buffered for every connected
+// client by default.
+const DefaultSSEClientBuffer = 256
+
+// WithSSESlowClients sets number of events buffered for every client and how
+// many events a client could miss before it is disconnected. Router never
+// waits for a client: when its buffer is full events are dropped and the
+// client receives a dropped event telling how many it missed. Clients are
+// never disconnected when maxLag is zero. Disconnected clients reconnect and
+// receive missed events which are still kept in history.
+func WithSSESlowClients(buffer, maxLag int) SSEOption {
+	return func(t *sse) {
+		t.clientBuffer = buffer
+		t.maxLag = maxLag
+	}
+}
+
+// DefaultSSEHeartbeat is the default interval of keepalive comments sent to
+// idle clients.
+const DefaultSSEHeartbeat = 15 * time.Second
+
+// WithSSEHeartbeat sets interval of keepalive comments sent to clients, so
+// that proxies do not cut idle streams. Zero disables heartbeats.
+func WithSSEHeartbeat(interval time.Duration) SSEOption {
+	return func(t *sse) {
+		t.heartbeat = interval
+	}
+}
+
+// DefaultSSESpillThreshold is the size of bodies above which they are
+// stored on disk by default.
+const DefaultSSESpillThreshold = 64 << 10
+
+// WithSSESpillThreshold makes bodies larger than n bytes be stored in
+// temporary directory instead of memory, events carry only a reference and
+// the UI fetches bodies when they are viewed. Zero keeps all bodies in events.
+func WithSSESpillThreshold(n int) SSEOption {
+	return func(t *sse) {
+		t.spillThreshold = n
+	}
+}
+
+// harExportLimit is the number of most recent completed round trips
+// available for export as HAR from the streaming server.
+const harExportLimit = 1000
+
+// Notify queues round trip to be sent to connected clients without waiting
+// for delivery. Storing of large bodies and serialization happen later, off
+// the request path.
 func (t *sse) Notify(rtl RoundTripLog) {
-	json := serializeOrDie(rtl)
-	t.distributor <- json
+	t.queue.push(rtl)
+}
+
+// spill replaces large bodies with references to stored ones. Log is shared
+// with other notifiers, so request and response logs are copied.
+func (t *sse) spill(rtl RoundTripLog) RoundTripLog {
+	if t.spillThreshold <= 0 {
+		return rtl
+	}
+	if req := rtl.RequestLog; req != nil && len(req.Body) > t.spillThreshold {
+		if ref, err := t.bodies.put(rtl.ID, requestBody, req.Body); err == nil {
+			r := *req
+			r.Body, r.BodyRef = "", ref
+			rtl.RequestLog = &r
+		} else if err != errBodyStoreClosed {
+			log.Println(err)
+		}
+	}
+	if res := rtl.ResponseLog; res != nil && len(res.Body) > t.spillThreshold {
+		if ref, err := t.bodies.put(rtl.ID, responseBody, res.Body); err == nil {
+			r := *res
+			r.Body, r.BodyRef = "", ref
+			rtl.ResponseLog = &r
+		} else if err != errBodyStoreClosed {
+			log.Println(err)
+		}
+	}
+	return rtl
+}
+
+// Stats reports counters of the queue of events, including dropped ones.
+func (t *sse) Stats() QueueStats {
+	return t.queue.stats()
+}
+
+// forward prepares queued round trips and passes them to the router until the
+// queue is closed and drained.
+func (t *sse) forward() {
+	defer close(t.forwarded)
+	for {
+		rtl, ok := t.queue.pop()
+		if !ok {
+			return
+		}
+		rtl = t.spill(rtl)
+		t.archive.add(rtl)
+		select {
+		case t.distributor <- newRoundTripEvent(rtl):
+		case <-t.stopping:
+			return
+		}
+	}
 }
 
 func serializeOrDie(stuff interface{}) []byte {
@@ -40,58 +242,277 @@ func serializeOrDie(stuff interface{}) []byte {
 //go:embed ui
 var content embed.FS
 
-func NewSSENotifier() (transport *sse) {
+func NewSSENotifier(opts ...SSEOption) (transport *sse) {
 	transport = &sse{
-		distributor:          make(chan []byte),
-		openingClients:       make(chan chan []byte),
-		connectedClients:     make(map[chan []byte]bool),
-		closingClients:       make(chan chan []byte),
-		firstClientConnected: false,
-		startServer: func() {
-			mux := http.NewServeMux()
-			mux.Handle("/events", transport)
-			if os.Getenv("DEV_MODE") != "" {
-				_, b, _, _ := runtime.Caller(0)
-				path := fmt.Sprintf("%s/ui", filepath.Dir(b))
-				// fmt.Println("Here", path)
-				mux.Handle("/", http.FileServer(http.Dir(path)))
-			} else {
-				mux.Handle("/", rootPath("/ui", http.FileServer(http.FS(content))))
-			}
-			log.Fatal("HTTP server error: ", http.ListenAndServe("localhost:8989", mux))
-		},
+		distributor:      make(chan sseEvent),
+		openingClients:   make(chan *sseClient),
+		connectedClients: make(map[*sseClient]bool),
+		closingClients:   make(chan *sseClient),
+		enoughClients:    make(chan struct{}),
+		waitClients:      1,
+		historySize:      DefaultQueueSize,
+		clientBuffer:     DefaultSSEClientBuffer,
+		maxLag:           DefaultQueueSize,
+		heartbeat:        DefaultSSEHeartbeat,
+		spillThreshold:   DefaultSSESpillThreshold,
+		forwarded:        make(chan struct{}),
+		stopping:         make(chan struct{}),
+		routerDone:       make(chan struct{}),
+		archive:          &harArchive{limit: harExportLimit},
+		queueSize:        DefaultQueueSize,
+		overflow:         DropOldest,
+		addr:             DefaultSSEAddr,
+		epoch:            strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	transport.startServer = transport.serve
+	for _, opt := range opts {
+		opt(transport)
+	}
+	if transport.waitClients <= 0 {
+		close(transport.enoughClients)
 	}
+	transport.bodies = newBodyStore(max(transport.historySize, harExportLimit))
+	transport.archive.bodies = transport.bodies
+	transport.queue = newQueue[RoundTripLog](transport.queueSize, transport.overflow)
 
 	return transport
 }
 
-func rootPath(staticDir string, h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/" {
-			r.URL.Path = fmt.Sprintf("/%s/", staticDir)
-		} else {
-			b := strings.Split(r.URL.Path, "/")[0]
-			if b != staticDir {
-				r.URL.Path = fmt.Sprintf("/%s%s", staticDir, r.URL.Path)
+// Handler returns handler serving the UI, events stream and HAR export which
+// could be mounted on an existing server under prefix, e.g. "/debug/witness".
+// Use WithoutSSEServer to avoid starting a separate server.
+func (t *sse) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	h := t.handler()
+	if prefix == "" {
+		return t.protect(h, "/")
+	}
+	strip := http.StripPrefix(prefix, h)
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == prefix {
+			// UI refers to resources relative to the mount point, query
+			// keeps the token
+			target := prefix + "/"
+			if req.URL.RawQuery != "" {
+				target += "?" + req.URL.RawQuery
 			}
+			http.Redirect(rw, req, target, http.StatusMovedPermanently)
+			return
 		}
-		h.ServeHTTP(w, r)
+		t.protect(strip, prefix+"/").ServeHTTP(rw, req)
 	})
 }
 
-func (t *sse) Init(ctx context.Context) {
-	t.ctx = ctx
-	t.firstClient = make(chan bool, 1)
+// handler serves the UI, events stream and HAR export.
+func (t *sse) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/events", t)
+	mux.Handle("/export.har", t.archive)
+	mux.Handle("GET /bodies/{id}/{direction}", t.bodies)
+	if os.Getenv("DEV_MODE") != "" {
+		_, b, _, _ := runtime.Caller(0)
+		path := fmt.Sprintf("%s/ui", filepath.Dir(b))
+		// fmt.Println("Here", path)
+		mux.Handle("/", http.FileServer(http.Dir(path)))
+	} else {
+		ui, err := fs.Sub(content, "ui")
+		if err != nil {
+			panic(err)
+		}
+		mux.Handle("/", http.FileServer(http.FS(ui)))
+	}
+	return mux
+}
+
+// serve binds the listener and serves the handler in background.
+func (t *sse) serve() error {
+	config, err := t.tlsConfig()
+	if err != nil {
+		return err
+	}
+	l := t.listener
+	if l == nil {
+		l, err = net.Listen("tcp", t.addr)
+		if err != nil {
+			return fmt.Errorf("witness: starting streaming server: %w", err)
+		}
+	}
+	scheme := "http"
+	if config != nil {
+		l = tls.NewListener(l, config)
+		scheme = "https"
+		fmt.Printf("witness TLS certificate SHA-256 fingerprint: %s\n", t.fingerprint)
+	}
+	t.url = serverURL(scheme, l.Addr())
+	t.server = &http.Server{Handler: t.Handler("")}
+	go func() {
+		if err := t.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Println("witness: streaming server error:", err)
+		}
+	}()
+	return nil
+}
+
+// serverURL makes url of the server listening on addr, unspecified host is
+// reported as localhost.
+func serverURL(scheme string, addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return fmt.Sprintf("%s://%s/", scheme, addr)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(host, port))
+}
+
+// URL returns address of the UI once the server is started, including
+// access token.
+func (t *sse) URL() string {
+	if t.url == "" || t.Token() == "" {
+		return t.url
+	}
+	return t.url + "?" + sseTokenParam + "=" + t.Token()
+}
+
+// Start starts routing of events and the streaming server, it returns error
+// when the server could not be started, e.g. because the port is taken.
+// Server is shut down when ctx is done. Subsequent calls do nothing, so that
+// the notifier could be shared, e.g. by several debugged clients.
+func (t *sse) Start(ctx context.Context) error {
+	if !t.started.CompareAndSwap(false, true) {
+		return nil
+	}
+	t.startedAt = time.Now()
+	go t.forward()
 	go t.route()
-	go t.startServer()
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := t.Shutdown(shutdownCtx); err != nil {
+				log.Println("witness: streaming server shutdown:", err)
+			}
+		case <-t.routerDone:
+		}
+	}()
+	return t.startServer()
+}
+
+// shutdownTimeout limits graceful shutdown triggered by Init context.
+const shutdownTimeout = 5 * time.Second
+
+// Shutdown stops accepting round trips, delivers pending events to connected
+// clients, closes their streams with a final close-app event, stops routing
+// and shuts the server down. Subsequent calls return result of the first one.
+func (t *sse) Shutdown(ctx context.Context) error {
+	t.shutdownOnce.Do(func() {
+		t.queue.close()
+		if t.started.Load() {
+			select {
+			case <-t.forwarded:
+			case <-ctx.Done():
+			}
+		}
+		close(t.stopping)
+		if t.started.Load() {
+			select {
+			case <-t.routerDone:
+			case <-ctx.Done():
+			}
+		}
+		if t.server != nil {
+			t.shutdownErr = t.server.Shutdown(ctx)
+		}
+		if err := t.bodies.close(); err != nil && t.shutdownErr == nil {
+			t.shutdownErr = err
+		}
+	})
+	return t.shutdownErr
+}
+
+// Close shuts the notifier down without deadline.
+func (t *sse) Close() error {
+	return t.Shutdown(context.Background())
+}
+
+// Init starts the notifier and waits for clients to connect according to
+// WithSSEWaitForClients. Unlike Start it does not fail: when the server could
+// not be started, error is logged and round trips are discarded.
+func (t *sse) Init(ctx context.Context) {
+	if t.started.Load() {
+		// already initialized for another client
+		return
+	}
+	if err := t.Start(ctx); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if t.URL() != "" {
+		fmt.Printf("witness UI is served at %s\n", t.URL())
+	} else if t.Token() != "" {
+		fmt.Printf("witness UI access token is %s\n", t.Token())
+	}
+
+	if t.waitClients <= 0 {
+		return
+	}
+
+	if t.waitClients == 1 {
+		fmt.Println("waiting for the first client to connect to events streaming server")
+	} else {
+		fmt.Printf("waiting for %d clients to connect to events streaming server\n", t.waitClients)
+	}
+
+	var timeout <-chan time.Time
+	if t.waitTimeout > 0 {
+		timer := time.NewTimer(t.waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
-	// wait until first client connected
-	// TODO: make waiting configurable
-	fmt.Println("waiting for the first client to connect to http://localhost:8989/ events streaming server")
+	select {
+	case <-t.enoughClients:
+		if t.waitClients == 1 {
+			fmt.Println("first client connected")
+		} else {
+			fmt.Printf("%d clients connected\n", t.waitClients)
+		}
+	case <-timeout:
+		fmt.Println("no clients connected in time, proceeding with events buffered")
+	case <-ctx.Done():
+	}
+}
+
+// clientConnected counts connected clients to release Init.
+func (t *sse) clientConnected() {
+	t.clientsMu.Lock()
+	defer t.clientsMu.Unlock()
+	t.clientsSeen++
+	if t.clientsSeen == t.waitClients {
+		close(t.enoughClients)
+	}
+}
 
-	<-t.firstClient
+// Replay makes the server send logs to every client upon connection, this
+// allows viewing of previously captured round trips, e.g. loaded with LoadCapture.
+func (t *sse) Replay(logs []RoundTripLog) {
+	t.replayMu.Lock()
+	defer t.replayMu.Unlock()
+	t.bodies.grow(len(logs))
+	for _, rtl := range logs {
+		rtl = t.spill(rtl)
+		t.archive.add(rtl)
+		t.replay = append(t.replay, newRoundTripEvent(rtl))
+	}
+}
 
-	fmt.Println("first client connected")
+func (t *sse) replayed() []sseEvent {
+	t.replayMu.Lock()
+	defer t.replayMu.Unlock()
+	return t.replay
 }
 
 func (t *sse) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -107,51 +528,252 @@ func (t *sse) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	header.Set("Content-Type", "text/event-stream")
 	header.Set("Cache-Control", "no-cache")
 	header.Set("Connection", "keep-alive")
-	header.Set("Access-Control-Allow-Origin", "*")
 
-	ch := make(chan []byte)
-
-	if !t.firstClientConnected {
-		t.firstClientConnected = true
-		t.firstClient <- true
+	c := &sseClient{
+		messages: make(chan []byte, max(t.clientBuffer, 0)),
+		backlog:  make(chan []sseMessage, 1),
 	}
+	c.lastEventID, c.resume = t.lastEventID(req)
 
-	t.openingClients <- ch
+	t.clientConnected()
+	select {
+	case t.openingClients <- c:
+	case <-t.routerDone:
+		writeCloseEvent(rw, flusher)
+		return
+	}
 
 	defer func() {
-		t.closingClients <- ch
+		select {
+		case t.closingClients <- c:
+		case <-t.routerDone:
+		}
 	}()
 
 	go func() {
 		<-req.Context().Done()
-		t.closingClients <- ch
+		select {
+		case t.closingClients <- c:
+		case <-t.routerDone:
+		}
 	}()
 
+	rw.Write(formatSSEFrame("", t.serverInfo()))
+	if !c.resume {
+		for _, e := range t.replayed() {
+			rw.Write(formatSSEFrame("", e))
+		}
+	}
+	// history is written here rather than queued, it may not fit the buffer
+	for _, m := range <-c.backlog {
+		rw.Write(m.frame)
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if t.heartbeat > 0 {
+		ticker := time.NewTicker(t.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	controller := http.NewResponseController(rw)
 	for {
+		var message []byte
+		select {
+		case m, ok := <-c.messages:
+			if !ok {
+				controller.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+				// router closes stream on shutdown or when client is too slow
+				writeCloseEvent(rw, flusher)
+				return
+			}
+			message = m
+		case <-heartbeat:
+			// comments are ignored by clients but keep connection busy
+			message = []byte(": keepalive\n\n")
+		}
+		// frozen client must not hold the handler forever
+		controller.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := rw.Write(message); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// sseWriteTimeout limits time spent writing a single event to a client.
+const sseWriteTimeout = 10 * time.Second
+
+// writeCloseEvent tells client that the server is going away.
+func writeCloseEvent(rw http.ResponseWriter, flusher http.Flusher) {
+	fmt.Fprint(rw, "event: close-app\ndata: {}\n\n")
+	flusher.Flush()
+}
+
+// sseClient is a connected events stream.
+type sseClient struct {
+	messages chan []byte
+	// backlog receives events from history the client has to catch up with.
+	backlog chan []sseMessage
+	// dropped is the number of events the client missed since the last
+	// one delivered.
+	dropped int
+	// lastEventID is the id of the last event received by reconnecting client.
+	lastEventID uint64
+	resume      bool
+}
+
+// lastEventID reads id of the last event received by the client before
+// reconnecting. Browsers send it in header when EventSource reconnects, UI
+// also passes it as query parameter when it opens a new EventSource. Event
+// ids are prefixed with epoch of the process, ids received from another
+// process, e.g. before restart, are ignored.
+func (t *sse) lastEventID(req *http.Request) (uint64, bool) {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("lastEventId")
+	}
+	epoch, n, ok := strings.Cut(value, "-")
+	if !ok || epoch != t.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(n, 10, 64)
+	return id, err == nil
+}
+
+// Names of events sent to clients.
+const (
+	eventRoundTripUpdate = "roundtrip.update"
+	eventRoundTripDone   = "roundtrip.done"
+	eventServerInfo      = "server.info"
+	eventDropped         = "dropped"
+)
+
+// sseEvent is a named event to be sent to clients.
+type sseEvent struct {
+	name string
+	data []byte
+}
+
+func newRoundTripEvent(rtl RoundTripLog) sseEvent {
+	name := eventRoundTripUpdate
+	if rtl.Done {
+		name = eventRoundTripDone
+	}
+	return sseEvent{name, serializeOrDie(rtl)}
+}
+
+// sseServerInfo is sent to every client upon connection.
+type sseServerInfo struct {
+	URL       string     `json:"url"`
+	StartedAt time.Time  `json:"startedAt"`
+	History   int        `json:"history"`
+	Queue     QueueStats `json:"queue"`
+}
+
+func (t *sse) serverInfo() sseEvent {
+	return sseEvent{eventServerInfo, serializeOrDie(sseServerInfo{
+		URL:       t.url,
+		StartedAt: t.startedAt,
+		History:   t.historySize,
+		Queue:     t.Stats(),
+	})}
+}
+
+// formatSSEFrame formats event for the stream, id is omitted when empty.
+func formatSSEFrame(id string, e sseEvent) []byte {
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", e.name, e.data)
+	return []byte(b.String())
+}
+
+// sseMessage is an event formatted for sending to clients.
+type sseMessage struct {
+	id    uint64
+	frame []byte
+}
+
+func newSSEMessage(epoch string, id uint64, e sseEvent) sseMessage {
+	return sseMessage{id, formatSSEFrame(fmt.Sprintf("%s-%d", epoch, id), e)}
+}
+
+// send passes message to the client without waiting, message is dropped when
+// buffer of the client is full. Client receives a dropped event before the
+// next delivered message and is disconnected when it missed more than maxLag
+// events in a row.
+func (t *sse) send(c *sseClient, frame []byte) {
+	if c.dropped > 0 {
 		select {
-		case data := <-ch:
-			// t := time.Now()
-			// fmt.Printf("%s sending %d bytes of data\n", t.Format("2006/01/02 15:04:05"), len(data))
-			fmt.Fprintf(rw, "data: %s\n\n", data)
-			flusher.Flush()
-		case <-t.ctx.Done():
+		case c.messages <- newDroppedFrame(c.dropped):
+			c.dropped = 0
+		default:
+		}
+	}
+	if c.dropped == 0 {
+		select {
+		case c.messages <- frame:
 			return
+		default:
 		}
 	}
+	c.dropped++
+	if t.maxLag > 0 && c.dropped > t.maxLag {
+		log.Printf("witness: disconnecting client missed %d events\n", c.dropped)
+		close(c.messages)
+		delete(t.connectedClients, c)
+	}
+}
+
+// newDroppedFrame formats event telling client how many events it missed.
+func newDroppedFrame(n int) []byte {
+	return formatSSEFrame("", sseEvent{eventDropped, []byte(fmt.Sprintf(`{"dropped":%d}`, n))})
 }
 
 func (t *sse) route() {
+	// recent events sent to clients upon connection
+	var history []sseMessage
+	var lastID uint64
 	for {
 		select {
-		case s := <-t.openingClients:
+		case c := <-t.openingClients:
 			fmt.Println("new client connected")
-			t.connectedClients[s] = true
+			t.connectedClients[c] = true
+			var backlog []sseMessage
+			for _, m := range history {
+				if !c.resume || m.id > c.lastEventID {
+					backlog = append(backlog, m)
+				}
+			}
+			c.backlog <- backlog
 		case event := <-t.distributor:
+			lastID++
+			m := newSSEMessage(t.epoch, lastID, event)
+			if t.historySize > 0 {
+				if len(history) >= t.historySize {
+					history = history[1:]
+				}
+				history = append(history, m)
+			}
 			for c := range t.connectedClients {
-				c <- event
+				t.send(c, m.frame)
+			}
+		case c := <-t.closingClients:
+			if t.connectedClients[c] {
+				// ends stream of disconnected client
+				close(c.messages)
+				delete(t.connectedClients, c)
 			}
-		case s := <-t.closingClients:
-			delete(t.connectedClients, s)
+		case <-t.stopping:
+			for c := range t.connectedClients {
+				close(c.messages)
+				delete(t.connectedClients, c)
+			}
+			close(t.routerDone)
+			return
 		}
 	}
 }
@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -14,10 +17,58 @@ import (
 func TestNotify(t *testing.T) {
 	url := "http://example.com"
 	tr := NewSSENotifier()
+	// forward without routing, so that events could be read here
+	go tr.forward()
 	go tr.Notify(RoundTripLog{RequestLog: &RequestLog{Url: url}})
 	msg := <-tr.distributor
-	if !strings.Contains(string(msg), url) {
-		t.Errorf(`Expected msg to contain "%v", got %s`, url, msg)
+	if !strings.Contains(string(msg.data), url) {
+		t.Errorf(`Expected msg to contain "%v", got %s`, url, msg.data)
+	}
+	if msg.name != "roundtrip.update" {
+		t.Errorf("expected event of unfinished round trip to be roundtrip.update, got %s", msg.name)
+	}
+
+	go tr.Notify(RoundTripLog{Done: true})
+	if msg := <-tr.distributor; msg.name != "roundtrip.done" {
+		t.Errorf("expected event of finished round trip to be roundtrip.done, got %s", msg.name)
+	}
+}
+
+// testEvent is an event received from the stream.
+type testEvent struct {
+	id, name, data string
+}
+
+// readEvent reads the next event from the stream skipping heartbeats.
+func readEvent(reader *bufio.Reader) (testEvent, error) {
+	var e testEvent
+	for {
+		l, err := reader.ReadString('\n')
+		if err != nil {
+			return e, err
+		}
+		l = strings.TrimSuffix(l, "\n")
+		switch {
+		case l == "" && e.name != "":
+			return e, nil
+		case strings.HasPrefix(l, "id: "):
+			e.id = strings.TrimPrefix(l, "id: ")
+		case strings.HasPrefix(l, "event: "):
+			e.name = strings.TrimPrefix(l, "event: ")
+		case strings.HasPrefix(l, "data: "):
+			e.data = strings.TrimPrefix(l, "data: ")
+		}
+	}
+}
+
+func TestNotifyDoesNotBlock(t *testing.T) {
+	tr := NewSSENotifier(WithSSEQueue(1, DropNewest))
+	// nobody is routing events, notifications must not wait for delivery
+	for i := 0; i < 3; i++ {
+		tr.Notify(RoundTripLog{})
+	}
+	if stats := tr.Stats(); stats.Dropped == 0 {
+		t.Errorf("expected dropped events to be counted, got %+v", stats)
 	}
 }
 
@@ -52,7 +103,7 @@ func TestServeHTTP(t *testing.T) {
 
 		// override startServer function to start our replacement test server
 		// instead of the real one
-		tr.startServer = func() {
+		tr.startServer = func() error {
 			sse.Start()
 
 			go func() {
@@ -64,23 +115,28 @@ func TestServeHTTP(t *testing.T) {
 				}
 
 				reader := bufio.NewReader(res.Body)
-				// sse is a streaming server so we have to read line by line
-				// just one line is enough here, because we only going to log one-1
-				l, _ := reader.ReadBytes('\n')
-
+				// sse is a streaming server so we have to read event by event,
+				// server describes itself first
+				info, _ := readEvent(reader)
+				if info.name != "server.info" {
+					t.Errorf("expected server.info event first, got %+v", info)
+				}
+				e, _ := readEvent(reader)
 				res.Body.Close()
-				result := string(l)
 
-				if !strings.HasPrefix(result, "data:") {
-					t.Errorf("expected body to have prefix 'data:', got %s", result)
+				if e.id == "" {
+					t.Errorf("expected event to have id, got %+v", e)
 				}
-
-				if !strings.Contains(result, "example.com") {
-					t.Errorf("expected body to contain 'example.com', got %s", result)
+				if e.name != "roundtrip.update" {
+					t.Errorf("expected roundtrip.update event, got %+v", e)
+				}
+				if !strings.Contains(e.data, "example.com") {
+					t.Errorf("expected data to contain 'example.com', got %s", e.data)
 				}
 
 				cancel()
 			}()
+			return nil
 		}
 
 		tr.Init(ctx)
@@ -88,6 +144,31 @@ func TestServeHTTP(t *testing.T) {
 		tr.Notify(RoundTripLog{RequestLog: &RequestLog{Url: "http://example.com"}})
 	})
 
+	t.Run("heartbeat", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer(), WithSSEHeartbeat(10*time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		tr.Start(ctx)
+		server := httptest.NewServer(tr)
+		defer server.Close()
+		defer cancel()
+
+		res, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		reader := bufio.NewReader(res.Body)
+		for {
+			l, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l == ": keepalive\n" {
+				break
+			}
+		}
+	})
+
 	t.Run("flusher not supported", func(t *testing.T) {
 		xx := &x{make(map[string][]string), 0, ""}
 		tr := NewSSENotifier()
@@ -103,6 +184,408 @@ func TestServeHTTP(t *testing.T) {
 	})
 }
 
+func TestReplay(t *testing.T) {
+	tr := NewSSENotifier()
+	tr.Replay([]RoundTripLog{sampleRoundTrip("replayed-1"), sampleRoundTrip("replayed-2")})
+	sse := httptest.NewUnstartedServer(tr)
+	defer sse.Close()
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	done := make(chan struct{})
+	tr.startServer = func() error {
+		sse.Start()
+		go func() {
+			defer close(done)
+			res, err := http.Get(sse.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer res.Body.Close()
+			reader := bufio.NewReader(res.Body)
+			// skip server.info
+			readEvent(reader)
+			for _, id := range []string{"replayed-1", "replayed-2"} {
+				e, _ := readEvent(reader)
+				if !strings.Contains(e.data, id) {
+					t.Errorf("expected %s to be replayed, got %+v", id, e)
+				}
+			}
+		}()
+		return nil
+	}
+	tr.Init(ctx)
+	<-done
+}
+
+func TestStart(t *testing.T) {
+	t.Run("any free port", func(t *testing.T) {
+		tr := NewSSENotifier(WithSSEAddr("localhost:0"))
+		if err := tr.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer tr.server.Close()
+		if !strings.HasPrefix(tr.URL(), "http://") || strings.HasSuffix(tr.URL(), ":0/") {
+			t.Errorf("expected chosen port to be reported, got %v", tr.URL())
+		}
+		res, err := http.Get(tr.URL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected UI to be served, got %v", res.Status)
+		}
+	})
+
+	t.Run("port taken", func(t *testing.T) {
+		l, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		tr := NewSSENotifier(WithSSEAddr(l.Addr().String()))
+		if err := tr.Start(context.Background()); err == nil {
+			t.Error("expected error when port is taken")
+		}
+	})
+
+	t.Run("listener", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := NewSSENotifier(WithSSEListener(l), WithSSEToken(""))
+		if err := tr.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer tr.server.Close()
+		_, port, _ := net.SplitHostPort(l.Addr().String())
+		if tr.URL() != "http://127.0.0.1:"+port+"/" {
+			t.Errorf("unexpected url %v", tr.URL())
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	tr := NewSSENotifier(WithoutSSEServer(), WithSSEToken(""))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := tr.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tr.URL() != "" {
+		t.Errorf("expected no server to be started, got %v", tr.URL())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/witness/", tr.Handler("/debug/witness/"))
+	mux.Handle("/debug/witness", tr.Handler("/debug/witness/"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	// event stream lasts until notifier context is done
+	defer cancel()
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(server.URL + "/debug/witness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != "/debug/witness/" {
+		t.Errorf("expected redirect to the mount point, got %v %v", res.Status, res.Header.Get("Location"))
+	}
+
+	for _, path := range []string{"/debug/witness/", "/debug/witness/index.js", "/debug/witness/export.har"} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected %v to be served, got %v", path, res.Status)
+		}
+	}
+
+	// happened before the client connected, delivered from history
+	tr.Notify(RoundTripLog{RequestLog: &RequestLog{Url: "http://example.com"}})
+	res, err = http.Get(server.URL + "/debug/witness/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	reader := bufio.NewReader(res.Body)
+	// skip server.info
+	readEvent(reader)
+	if e, _ := readEvent(reader); !strings.Contains(e.data, "example.com") {
+		t.Errorf("expected events to be streamed, got %+v", e)
+	}
+}
+
+func TestInitWaitPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("no wait", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer(), WithSSEWaitForClients(0, 0))
+		initialized := make(chan bool)
+		go func() {
+			tr.Init(ctx)
+			initialized <- true
+		}()
+		select {
+		case <-initialized:
+		case <-time.After(time.Second):
+			t.Error("expected Init not to wait for clients")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer(), WithSSEWaitForClients(1, 10*time.Millisecond))
+		started := time.Now()
+		tr.Init(ctx)
+		if time.Since(started) < 10*time.Millisecond {
+			t.Error("expected Init to wait until timeout")
+		}
+	})
+
+	t.Run("several clients", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer(), WithSSEWaitForClients(2, 0))
+		server := httptest.NewServer(tr)
+		defer server.Close()
+		clientCtx, disconnect := context.WithCancel(ctx)
+		defer disconnect()
+
+		initialized := make(chan bool)
+		go func() {
+			tr.Init(ctx)
+			initialized <- true
+		}()
+		connect := func() {
+			req, _ := http.NewRequestWithContext(clientCtx, "GET", server.URL, nil)
+			go http.DefaultClient.Do(req)
+		}
+
+		connect()
+		select {
+		case <-initialized:
+			t.Fatal("expected Init to wait for the second client")
+		case <-time.After(20 * time.Millisecond):
+		}
+		connect()
+		select {
+		case <-initialized:
+		case <-time.After(time.Second):
+			t.Error("expected Init to return once two clients connected")
+		}
+		cancel()
+	})
+}
+
+func TestHistory(t *testing.T) {
+	tr := NewSSENotifier(WithoutSSEServer(), WithSSEHistory(2))
+	ctx, cancel := context.WithCancel(context.Background())
+	tr.Start(ctx)
+	server := httptest.NewServer(tr)
+	defer server.Close()
+	defer cancel()
+
+	for _, id := range []string{"1", "2", "3"} {
+		tr.Notify(RoundTripLog{ID: id})
+	}
+
+	// readEvents connects to the stream and reads events until the one with
+	// untilID returning their ids
+	readEvents := func(lastEventID string, untilID string) []string {
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(res.Body)
+		ids := []string{}
+		for len(ids) == 0 || ids[len(ids)-1] != untilID {
+			l, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(l, "id: ") {
+				id := strings.TrimSpace(strings.TrimPrefix(l, "id: "))
+				ids = append(ids, strings.TrimPrefix(id, tr.epoch+"-"))
+			}
+		}
+		return ids
+	}
+
+	// make sure all events are routed
+	readEvents("", "3")
+	if ids := readEvents("", "3"); strings.Join(ids, ",") != "2,3" {
+		t.Errorf("expected new client to receive recent history, got %v", ids)
+	}
+
+	tr.Notify(RoundTripLog{ID: "4"})
+	// event 4 is either in history or delivered live, anyway the only one missed
+	if ids := readEvents(tr.epoch+"-3", "4"); len(ids) != 1 {
+		t.Errorf("expected reconnecting client to receive missed event, got %v", ids)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	tr := NewSSENotifier()
+	req := httptest.NewRequest("GET", "/events?lastEventId="+tr.epoch+"-42", nil)
+	if id, ok := tr.lastEventID(req); !ok || id != 42 {
+		t.Errorf("expected id from query, got %v %v", id, ok)
+	}
+	req.Header.Set("Last-Event-ID", tr.epoch+"-7")
+	if id, ok := tr.lastEventID(req); !ok || id != 7 {
+		t.Errorf("expected id from header, got %v %v", id, ok)
+	}
+	if _, ok := tr.lastEventID(httptest.NewRequest("GET", "/events", nil)); ok {
+		t.Error("expected new client not to resume")
+	}
+	// process restarted, event ids start over
+	req.Header.Set("Last-Event-ID", "previous-7")
+	if _, ok := tr.lastEventID(req); ok {
+		t.Error("expected ids of another process to be ignored")
+	}
+}
+
+func TestSlowClients(t *testing.T) {
+	// route feeds events to the router and waits until they are handled
+	route := func(tr *sse, ids ...int) {
+		for _, id := range ids {
+			tr.distributor <- sseEvent{"roundtrip.done", []byte(strconv.Itoa(id))}
+		}
+		sync := newTestClient()
+		tr.openingClients <- sync
+		tr.closingClients <- sync
+	}
+	received := func(c *sseClient) []string {
+		frames := []string{}
+		for {
+			select {
+			case frame, ok := <-c.messages:
+				if !ok {
+					return append(frames, "closed")
+				}
+				frames = append(frames, string(frame))
+			default:
+				return frames
+			}
+		}
+	}
+
+	t.Run("drops events", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer(), WithSSESlowClients(2, 0), WithSSEHistory(0))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tr.Start(ctx)
+		c := newTestClient()
+		tr.openingClients <- c
+
+		route(tr, 1, 2, 3, 4)
+		frames := received(c)
+		if len(frames) != 2 || !strings.HasPrefix(frames[1], "id: "+tr.epoch+"-2\n") {
+			t.Errorf("expected buffered events only, got %q", frames)
+		}
+
+		route(tr, 5)
+		frames = received(c)
+		if len(frames) != 2 || frames[0] != "event: dropped\ndata: {\"dropped\":2}\n\n" || !strings.HasPrefix(frames[1], "id: "+tr.epoch+"-5\n") {
+			t.Errorf("expected dropped event followed by new one, got %q", frames)
+		}
+	})
+
+	t.Run("disconnects lagging client", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer(), WithSSESlowClients(2, 1))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		tr.Start(ctx)
+		c := newTestClient()
+		tr.openingClients <- c
+
+		route(tr, 1, 2, 3, 4)
+		if frames := received(c); len(frames) != 3 || frames[2] != "closed" {
+			t.Errorf("expected client to be disconnected, got %q", frames)
+		}
+	})
+}
+
+// newTestClient makes client registered with the router directly, without
+// a connection.
+func newTestClient() *sseClient {
+	return &sseClient{
+		messages: make(chan []byte, 2),
+		backlog:  make(chan []sseMessage, 1),
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("closes streams and server", func(t *testing.T) {
+		tr := NewSSENotifier(WithSSEAddr("localhost:0"), WithSSEToken(""))
+		if err := tr.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.Get(tr.URL() + "events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		tr.Notify(RoundTripLog{ID: "pending"})
+		if err := tr.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		if !strings.Contains(string(body), `"id":"pending"`) {
+			t.Errorf("expected pending event to be delivered, got %s", body)
+		}
+		if !strings.HasSuffix(string(body), "event: close-app\ndata: {}\n\n") {
+			t.Errorf("expected stream to end with close event, got %s", body)
+		}
+		if _, err := http.Get(tr.URL()); err == nil {
+			t.Error("expected server to be shut down")
+		}
+
+		tr.Notify(RoundTripLog{})
+		if stats := tr.Stats(); stats.Dropped != 1 {
+			t.Errorf("expected round trips to be discarded after shutdown, got %+v", stats)
+		}
+	})
+
+	t.Run("on context cancellation", func(t *testing.T) {
+		tr := NewSSENotifier(WithoutSSEServer())
+		ctx, cancel := context.WithCancel(context.Background())
+		tr.Start(ctx)
+		cancel()
+		select {
+		case <-tr.routerDone:
+		case <-time.After(time.Second):
+			t.Error("expected router to be stopped")
+		}
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		tr := NewSSENotifier()
+		tr.Notify(RoundTripLog{})
+		if err := tr.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestServerURL(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv6unspecified, Port: 8989}
+	if url := serverURL("http", addr); url != "http://localhost:8989/" {
+		t.Errorf("expected unspecified host to be reported as localhost, got %v", url)
+	}
+}
+
 type x struct {
 	header     http.Header
 	statusCode int
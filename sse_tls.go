@@ -0,0 +1,127 @@
+package witness
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// WithSSETLS makes the streaming server serve HTTPS using certificate and
+// key from PEM encoded files.
+func WithSSETLS(certFile, keyFile string) SSEOption {
+	return func(t *sse) {
+		t.tlsCertFile = certFile
+		t.tlsKeyFile = keyFile
+	}
+}
+
+// WithSSESelfSignedTLS makes the streaming server serve HTTPS using
+// certificate generated in memory on start. Its fingerprint is printed, so
+// that it could be compared with the one reported by the browser.
+func WithSSESelfSignedTLS() SSEOption {
+	return func(t *sse) {
+		t.tlsSelfSigned = true
+	}
+}
+
+// tlsConfig returns configuration of the streaming server, nil when TLS is
+// not enabled.
+func (t *sse) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case t.tlsCertFile != "" || t.tlsKeyFile != "":
+		cert, err = tls.LoadX509KeyPair(t.tlsCertFile, t.tlsKeyFile)
+	case t.tlsSelfSigned:
+		var certPEM, keyPEM []byte
+		certPEM, keyPEM, err = selfSignedCertificate(certificateHosts(t.addr), time.Now())
+		if err == nil {
+			cert, err = tls.X509KeyPair(certPEM, keyPEM)
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("witness: loading certificate: %w", err)
+	}
+	t.fingerprint = certificateFingerprint(cert.Certificate[0])
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// certificateHosts lists names the self-signed certificate is valid for:
+// loopback, host of the address and name of the machine.
+func certificateHosts(addr string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	return hosts
+}
+
+// selfSignedCertificate generates PEM encoded certificate and key valid for
+// hosts, which could be either names or ip addresses.
+func selfSignedCertificate(hosts []string, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"witness"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// certificateFingerprint formats SHA-256 fingerprint of DER encoded
+// certificate the way browsers display it.
+func certificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,102 @@
+package witness
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLS(t *testing.T) {
+	// get fetches the UI trusting only certificate with fingerprint
+	get := func(url, fingerprint string) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if got := certificateFingerprint(cs.PeerCertificates[0].Raw); got != fingerprint {
+					t.Errorf("expected certificate with fingerprint %s, got %s", fingerprint, got)
+				}
+				return nil
+			},
+		}}}
+		res, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected UI to be served, got %v", res.Status)
+		}
+		return nil
+	}
+
+	t.Run("self-signed", func(t *testing.T) {
+		tr := NewSSENotifier(WithSSEAddr("localhost:0"), WithSSESelfSignedTLS())
+		if err := tr.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer tr.Close()
+		if !strings.HasPrefix(tr.URL(), "https://") {
+			t.Errorf("expected https url, got %v", tr.URL())
+		}
+		if len(tr.fingerprint) != 95 {
+			t.Errorf("expected SHA-256 fingerprint, got %q", tr.fingerprint)
+		}
+		if err := get(tr.URL(), tr.fingerprint); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("certificate files", func(t *testing.T) {
+		certPEM, keyPEM, err := selfSignedCertificate([]string{"localhost"}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		os.WriteFile(certFile, certPEM, 0o600)
+		os.WriteFile(keyFile, keyPEM, 0o600)
+
+		tr := NewSSENotifier(WithSSEAddr("localhost:0"), WithSSETLS(certFile, keyFile))
+		if err := tr.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer tr.Close()
+		cert, _ := tls.X509KeyPair(certPEM, keyPEM)
+		if err := get(tr.URL(), certificateFingerprint(cert.Certificate[0])); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		tr := NewSSENotifier(WithSSEAddr("localhost:0"), WithSSETLS("missing.pem", "missing.pem"))
+		if err := tr.Start(context.Background()); err == nil {
+			t.Error("expected error when certificate can not be loaded")
+		}
+	})
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	certPEM, keyPEM, err := selfSignedCertificate([]string{"localhost", "127.0.0.1", "example.test"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "example.test"} {
+		if err := leaf.VerifyHostname(host); err != nil {
+			t.Errorf("expected certificate to be valid for %s: %v", host, err)
+		}
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"crypto/tls"
 	"net/http/httptrace"
 	"net/textproto"
+	"sync"
 	"time"
 )
 
 type Timeline struct {
 	StartedAt time.Time `json:"startedAt"`
 	Events    []Event   `json:"events"`
+	// mu guards Events appended by httptrace callbacks and body wrappers
+	// running on different goroutines.
+	mu sync.Mutex
 }
 
 type Event struct {
@@ -49,10 +53,7 @@ func (tl *Timeline) tracer(flush func()) *httptrace.ClientTrace {
 		},
 
 		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
-			tl.logEvent("Got1xxResponse", struct {
-				Code   int                  `json:"code"`
-				Header textproto.MIMEHeader `json:"header"`
-			}{code, header})
+			tl.logEvent("Got1xxResponse", informationalResponse{code, header})
 			return nil
 		},
 
@@ -90,10 +91,7 @@ func (tl *Timeline) tracer(flush func()) *httptrace.ClientTrace {
 		},
 
 		WroteHeaderField: func(key string, value []string) {
-			tl.logEvent("WroteHeaderField", struct {
-				Key   string   `json:"key"`
-				Value []string `json:"value"`
-			}{key, value})
+			tl.logEvent("WroteHeaderField", headerField{key, value})
 		},
 
 		WroteHeaders: func() {
@@ -111,8 +109,22 @@ func (tl *Timeline) tracer(flush func()) *httptrace.ClientTrace {
 	}
 }
 
+// headerField is payload of WroteHeaderField event.
+type headerField struct {
+	Key   string   `json:"key"`
+	Value []string `json:"value"`
+}
+
+// informationalResponse is payload of Got1xxResponse event.
+type informationalResponse struct {
+	Code   int                  `json:"code"`
+	Header textproto.MIMEHeader `json:"header"`
+}
+
 func (tl *Timeline) logEvent(name string, payload interface{}) {
 	// fmt.Printf("%s: %+v\n", name, payload)
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
 	tl.Events = append(
 		tl.Events,
 		Event{
@@ -122,3 +134,15 @@ func (tl *Timeline) logEvent(name string, payload interface{}) {
 		},
 	)
 }
+
+// snapshot returns copy of the timeline not sharing events with the original.
+func (tl *Timeline) snapshot() *Timeline {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	events := make([]Event, len(tl.Events))
+	copy(events, tl.Events)
+	return &Timeline{
+		StartedAt: tl.StartedAt,
+		Events:    events,
+	}
+}
@@ -0,0 +1,97 @@
+package witness
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header name.
+const TraceparentHeader = "traceparent"
+
+// spanContext identifies a span according to W3C Trace Context.
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	flags   byte
+}
+
+func (sc spanContext) TraceID() string {
+	return hex.EncodeToString(sc.traceID[:])
+}
+
+func (sc spanContext) SpanID() string {
+	return hex.EncodeToString(sc.spanID[:])
+}
+
+func (sc spanContext) isValid() bool {
+	return sc.traceID != [16]byte{} && sc.spanID != [8]byte{}
+}
+
+// traceparent formats span context as a traceparent header value.
+func (sc spanContext) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID(), sc.SpanID(), sc.flags)
+}
+
+// child returns a new span context belonging to the same trace as parent, or
+// to a new sampled trace when parent is not valid.
+func (sc spanContext) child() spanContext {
+	child := spanContext{traceID: sc.traceID, flags: sc.flags}
+	if !sc.isValid() {
+		rand.Read(child.traceID[:])
+		child.flags = 1
+	}
+	rand.Read(child.spanID[:])
+	return child
+}
+
+// parseTraceparent parses traceparent header value, ok is false when value
+// does not conform to the spec.
+func parseTraceparent(value string) (sc spanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, false
+	}
+	sc.flags = flags[0]
+	return sc, sc.isValid()
+}
+
+// ContextWithTraceparent returns a copy of ctx carrying span context parsed
+// from traceparent header value, so that round trips made with the returned
+// context join the existing trace. Invalid values are ignored.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	sc, ok := parseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+	return contextWithSpan(ctx, sc)
+}
+
+// parentSpan finds span context of the parent of the request, it is taken
+// from the request context, or from traceparent header set by the caller.
+func parentSpan(req *http.Request) spanContext {
+	if sc, ok := spanFromContext(req.Context()); ok {
+		return sc
+	}
+	sc, _ := parseTraceparent(req.Header.Get(TraceparentHeader))
+	return sc
+}
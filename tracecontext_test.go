@@ -0,0 +1,129 @@
+package witness
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const sampleTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := parseTraceparent(sampleTraceparent)
+	if !ok {
+		t.Fatal("expected traceparent to be parsed")
+	}
+	if sc.TraceID() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID() != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span context %v %v", sc.TraceID(), sc.SpanID())
+	}
+	if sc.traceparent() != sampleTraceparent {
+		t.Errorf("expected %v, got %v", sampleTraceparent, sc.traceparent())
+	}
+
+	invalid := []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	}
+	for _, value := range invalid {
+		if _, ok := parseTraceparent(value); ok {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestSpanContextChild(t *testing.T) {
+	parent, _ := parseTraceparent(sampleTraceparent)
+	child := parent.child()
+	if child.TraceID() != parent.TraceID() {
+		t.Error("expected child to belong to the parent trace")
+	}
+	if child.SpanID() == parent.SpanID() || !child.isValid() {
+		t.Error("expected child to get a new span id")
+	}
+
+	root := spanContext{}.child()
+	if !root.isValid() {
+		t.Error("expected root span to start a new trace")
+	}
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	var received string
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Get(TraceparentHeader)
+		}))
+	defer testServer.Close()
+
+	t.Run("from context", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		client := &http.Client{Transport: NewTransport(nil, WithNotifier(notifier), WithTraceContextPropagation(true))}
+		ctx := ContextWithTraceparent(context.Background(), sampleTraceparent)
+		req, _ := http.NewRequestWithContext(ctx, "GET", testServer.URL, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		payload := notifier.payload
+		if payload.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || payload.ParentSpanID != "00f067aa0ba902b7" {
+			t.Errorf("unexpected trace %v parent span %v", payload.TraceID, payload.ParentSpanID)
+		}
+		expected := "00-" + payload.TraceID + "-" + payload.SpanID + "-01"
+		if received != expected {
+			t.Errorf("expected traceparent %v to be injected, got %v", expected, received)
+		}
+		if req.Header.Get(TraceparentHeader) != "" {
+			t.Error("expected original request to be left intact")
+		}
+	})
+
+	t.Run("from header without propagation", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		client := &http.Client{Transport: &Transport{Notifier: notifier}}
+		req, _ := http.NewRequest("GET", testServer.URL, nil)
+		req.Header.Set(TraceparentHeader, sampleTraceparent)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if notifier.payload.ParentSpanID != "00f067aa0ba902b7" {
+			t.Errorf("expected parent span from header, got %v", notifier.payload.ParentSpanID)
+		}
+		if received != sampleTraceparent {
+			t.Errorf("expected caller's traceparent to be sent as is, got %v", received)
+		}
+	})
+
+	t.Run("inbound", func(t *testing.T) {
+		inbound := &fakeNotifier{}
+		outbound := &fakeNotifier{}
+		client := &http.Client{Transport: &Transport{Notifier: outbound}}
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req, _ := http.NewRequestWithContext(r.Context(), "GET", testServer.URL, nil)
+			res, err := client.Do(req)
+			if err == nil {
+				res.Body.Close()
+			}
+		}), WithNotifier(inbound))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(TraceparentHeader, sampleTraceparent)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if inbound.payload.ParentSpanID != "00f067aa0ba902b7" {
+			t.Errorf("expected inbound parent span from header, got %v", inbound.payload.ParentSpanID)
+		}
+		if outbound.payload.TraceID != inbound.payload.TraceID || outbound.payload.ParentSpanID != inbound.payload.SpanID {
+			t.Error("expected outbound span to be a child of inbound span")
+		}
+	})
+}
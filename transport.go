@@ -0,0 +1,180 @@
+package witness
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transport is an http.RoundTripper eavesdropping on round trips made by Base
+// and reporting them to Notifier.
+type Transport struct {
+	// Base is the underlying round tripper, http.DefaultTransport when nil.
+	Base http.RoundTripper
+	// Notifier receives round trip logs, DefaultNotifier when nil.
+	Notifier Notifier
+	// CaptureBody enables capturing of request and response bodies.
+	CaptureBody bool
+	// MaxRequestBodySize and MaxResponseBodySize limit number of captured
+	// body bytes, the rest is passed through without being kept.
+	// DefaultMaxBodySize is used when zero, negative disables the limit.
+	MaxRequestBodySize  int64
+	MaxResponseBodySize int64
+	// PropagateTraceContext enables injecting of traceparent header into
+	// outgoing requests, so that the callee joins the trace.
+	PropagateTraceContext bool
+	// Redactor masks secrets before round trips are reported,
+	// DefaultRedactor when nil.
+	Redactor *Redactor
+}
+
+// NewTransport wraps base round tripper applying given options.
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	t := &Transport{Base: base}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) notifier() Notifier {
+	if t.Notifier == nil {
+		return DefaultNotifier
+	}
+	return t.Notifier
+}
+
+// DefaultMaxBodySize is the default limit of captured bytes of a body.
+const DefaultMaxBodySize = 1 << 20
+
+func bodyLimit(limit int64) int64 {
+	if limit == 0 {
+		return DefaultMaxBodySize
+	}
+	return limit
+}
+
+func (t *Transport) redactor() *Redactor {
+	if t.Redactor == nil {
+		return DefaultRedactor
+	}
+	return t.Redactor
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	includeBody := t.CaptureBody
+
+	startedAt := time.Now()
+	timeline := newTimeline(startedAt)
+	payload := &RoundTripLog{
+		ID:        uuid.NewString(),
+		Direction: Outbound,
+		Timeline:  timeline,
+	}
+	if parentID, ok := ParentIDFromContext(req.Context()); ok {
+		payload.ParentID = parentID
+	}
+	parent := parentSpan(req)
+	span := parent.child()
+	payload.TraceID = span.TraceID()
+	payload.SpanID = span.SpanID()
+	if parent.isValid() {
+		payload.ParentSpanID = parent.SpanID()
+	}
+	rec := newRecorder(t.notifier(), t.redactor(), payload)
+	trace := timeline.tracer(rec.notify)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	if t.PropagateTraceContext {
+		// round tripper must not modify the original request
+		header := req.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		req.Header = header
+		req.Header.Set(TraceparentHeader, span.traceparent())
+	}
+	payload.RequestLog = &RequestLog{
+		Method: req.Method,
+		Url:    req.URL.String(),
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+	}
+
+	if includeBody && req.Body != nil {
+		req.Body = &bodyWrapper{
+			body:  req.Body,
+			limit: bodyLimit(t.MaxRequestBodySize),
+			onReadingStart: func() {
+				timeline.logEvent("RequestBodyReadingStart", nil)
+			},
+			onReadingDone: func() {
+				timeline.logEvent("RequestBodyReadingDone", nil)
+			},
+			onClose: func(bw *bodyWrapper) {
+				timeline.logEvent("RequestBodyClosed", nil)
+				rec.update(func(p *RoundTripLog) {
+					p.RequestLog.captureBody(bw.content, bw.size, bw.limit)
+				})
+			},
+		}
+	}
+
+	res, err := t.base().RoundTrip(req)
+
+	if res != nil {
+		rec.update(func(p *RoundTripLog) {
+			p.ResponseLog = &ResponseLog{
+				Proto:         res.Proto,
+				Status:        string(res.Status),
+				StatusCode:    res.StatusCode,
+				Header:        res.Header.Clone(),
+				ContentLength: res.ContentLength,
+			}
+		})
+		rec.notify()
+	}
+
+	if err != nil {
+		rec.update(func(p *RoundTripLog) {
+			p.Error = &RequestError{
+				Message: err.Error(),
+				Details: err,
+			}
+		})
+	}
+
+	if includeBody && res != nil && res.Body != nil {
+		res.Body = &bodyWrapper{
+			body:  res.Body,
+			limit: bodyLimit(t.MaxResponseBodySize),
+			onReadingStart: func() {
+				timeline.logEvent("ResponseBodyReadingStart", nil)
+			},
+			onReadingDone: func() {
+				timeline.logEvent("ResponseBodyReadingDone", nil)
+			},
+			onClose: func(bw *bodyWrapper) {
+				timeline.logEvent("ResponseBodyClosed", nil)
+				rec.finish(func(p *RoundTripLog) {
+					p.ResponseLog.captureBody(bw.content, bw.size, bw.limit)
+					if p.ResponseLog.ContentLength == -1 {
+						p.ResponseLog.ContentLength = bw.size
+					}
+				})
+			},
+		}
+	} else {
+		rec.finish(nil)
+	}
+	return res, err
+}
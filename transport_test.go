@@ -0,0 +1,84 @@
+package witness
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+	defer testServer.Close()
+
+	t.Run("wraps base round tripper", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		base := &countingRoundTripper{base: http.DefaultTransport}
+		client := &http.Client{Transport: &Transport{Base: base, Notifier: notifier}}
+
+		api := API{client, testServer.URL}
+		api.CheckStatus()
+
+		if base.count != 1 {
+			t.Errorf("expected base round tripper to be called once, got %d", base.count)
+		}
+		if notifier.payload.ResponseLog.StatusCode != http.StatusTeapot {
+			t.Errorf("expected status %d, got %d", http.StatusTeapot, notifier.payload.ResponseLog.StatusCode)
+		}
+	})
+
+	t.Run("wrapper", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		wrap := Wrapper(WithNotifier(notifier))
+		client := &http.Client{Transport: wrap(nil)}
+
+		api := API{client, testServer.URL}
+		api.CheckStatus()
+
+		if !notifier.payload.Done {
+			t.Error("expected round trip to be reported")
+		}
+	})
+
+	t.Run("body limit", func(t *testing.T) {
+		echoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, r.Body)
+		}))
+		defer echoServer.Close()
+		notifier := &fakeNotifier{}
+		client := &http.Client{}
+		Instrument(client, WithNotifier(notifier), WithBodyCapture(true), WithBodyLimit(2, 3))
+
+		res, err := client.Post(echoServer.URL, "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if string(body) != "hello" {
+			t.Errorf("expected caller to receive whole body, got %q", body)
+		}
+		req, resLog := notifier.payload.RequestLog, notifier.payload.ResponseLog
+		if req.Body != "he" || req.BodySize != 5 || !req.BodyTruncated {
+			t.Errorf("expected request body to be truncated, got %+v", req)
+		}
+		if resLog.Body != "hel" || resLog.BodySize != 5 || !resLog.BodyTruncated {
+			t.Errorf("expected response body to be truncated, got %+v", resLog)
+		}
+	})
+}
+
+type countingRoundTripper struct {
+	base  http.RoundTripper
+	count int
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.count++
+	return c.base.RoundTrip(req)
+}
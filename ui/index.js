@@ -1,5 +1,7 @@
 let connection;
 let openRequests = new Map();
+let logsById = new Map();
+let lastEventId = null;
 let connected;
 let reconnectingTimeout = null;
 let activeLog = null;
@@ -9,19 +11,37 @@ function connect() {
     if (reconnectingTimeout) {
         clearTimeout(reconnectingTimeout);
     }
-    if (connection && connection.readyState === 2 || !connection) {
-        connection = new EventSource('http://localhost:8989/events');
+    if (connection && connection.readyState !== 2) {
+        // listeners are attached already
+        return;
     }
-    connection.onmessage = (e) => {
+    // resume after the last received event, server sends what we missed
+    connection = new EventSource(lastEventId ? `events?lastEventId=${encodeURIComponent(lastEventId)}` : 'events');
+    function onRoundTrip(e) {
+        if (e.lastEventId) {
+            lastEventId = e.lastEventId;
+        }
         localStorage.lastMessage = e.data;
         try {
             handle(JSON.parse(e.data));
         } catch (e) {
-            log.error('handle error', e);
+            console.error('handle error', e);
         }
-    };
+    }
+    connection.addEventListener('roundtrip.update', onRoundTrip);
+    connection.addEventListener('roundtrip.done', onRoundTrip);
+
+    connection.addEventListener('server.info', (e) => {
+        updateServerInfo(JSON.parse(e.data));
+    });
+
+    // events missed because the page could not keep up with the server
+    connection.addEventListener('dropped', (e) => {
+        updateDropped(JSON.parse(e.data).dropped);
+    });
 
-    // connection.addEventListener('close-app', onClose);
+    // server is shutting down, retry later instead of reconnecting right away
+    connection.addEventListener('close-app', onClose);
 
     connection.onopen = () => {
         updateConnected(true);
@@ -46,6 +66,10 @@ document.addEventListener("visibilitychange", (evt) => {
 
 let app;
 let header;
+let connectionStatus;
+let droppedStatus;
+let droppedCount = 0;
+let serverDroppedCount = 0;
 let details;
 
 document.addEventListener('beforeunload', () => {
@@ -62,6 +86,17 @@ if (document.readyState === 'complete') {
 function init() {
     header = document.createElement('div');
     header.className = 'header';
+    connectionStatus = document.createElement('span');
+    header.appendChild(connectionStatus);
+    droppedStatus = document.createElement('span');
+    droppedStatus.className = 'dropped';
+    header.appendChild(droppedStatus);
+    const exportLink = document.createElement('a');
+    exportLink.className = 'export';
+    exportLink.href = 'export.har';
+    exportLink.download = 'witness.har';
+    exportLink.innerText = 'export HAR';
+    header.appendChild(exportLink);
     document.body.appendChild(header);
 
     updateConnected(false);
@@ -107,13 +142,13 @@ function init() {
     document.addEventListener('keydown', (e) => {
         switch (e.code) {
             case 'KeyJ':
-                if (activeLog && activeLog.nextSibling) {
-                    activate(logByEl.get(activeLog.nextSibling));
+                if (activeLog && activeLog.parentNode.nextSibling) {
+                    activate(logByEl.get(activeLog.parentNode.nextSibling));
                 }
                 break;
             case 'KeyK':
-                if (activeLog && activeLog.previousSibling) {
-                    activate(logByEl.get(activeLog.previousSibling));
+                if (activeLog && activeLog.parentNode.previousSibling) {
+                    activate(logByEl.get(activeLog.parentNode.previousSibling));
                 }
                 break;
         }
@@ -127,7 +162,31 @@ function updateConnected(newValue) {
         return;
     }
     connected = newValue;
-    header.innerText = connected ? 'connected' : 'connecting...';
+    connectionStatus.innerText = connected ? 'connected' : 'connecting...';
+}
+
+function updateServerInfo(info) {
+    connectionStatus.title = `server started at ${new Date(info.startedAt).toLocaleString()}`;
+    if (info.queue.dropped > 0) {
+        serverDroppedCount = info.queue.dropped;
+        renderDropped();
+    }
+}
+
+function updateDropped(n) {
+    droppedCount += n;
+    renderDropped();
+}
+
+function renderDropped() {
+    const parts = [];
+    if (droppedCount > 0) {
+        parts.push(`${droppedCount} events dropped`);
+    }
+    if (serverDroppedCount > 0) {
+        parts.push(`${serverDroppedCount} dropped by server`);
+    }
+    droppedStatus.innerText = parts.join(', ');
 }
 
 function handle(data) {
@@ -135,8 +194,9 @@ function handle(data) {
 }
 
 function logRequest(rt) {
-    const { id, done } = rt;
-    let log = openRequests.get(id);
+    const { id, done, parentId } = rt;
+    // history replayed on reconnect may repeat known round trips
+    let log = openRequests.get(id) || logsById.get(id);
     if (log) {
         if (!log.rt.error && rt.error) {
             log.el.classList.add('error');
@@ -150,10 +210,22 @@ function logRequest(rt) {
         if (rt.error) {
             el.className += ' error';
         }
-        log = { el, rt };
+        const row = document.createElement('div');
+        row.className = 'row';
+        el.appendChild(row);
+        log = { el, row, rt };
+        row.addEventListener('mousedown', () => {
+            activate(log);
+        });
         openRequests.set(id, log);
+        logsById.set(id, log);
         logByEl.set(el, log);
-        app.appendChild(el);
+        const parent = parentId && logsById.get(parentId);
+        if (parent) {
+            childrenOf(parent).appendChild(el);
+        } else {
+            app.appendChild(el);
+        }
         el.sourceData = rt;
 
         render(log);
@@ -166,6 +238,19 @@ function logRequest(rt) {
     }
 }
 
+function childrenOf(log) {
+    if (!log.children) {
+        log.children = document.createElement('div');
+        log.children.className = 'children';
+        log.el.appendChild(log.children);
+    }
+    return log.children;
+}
+
+function endOf(rt) {
+    return new Date(rt.timeline.startedAt).valueOf() + rt.durationNano / 1_000_000;
+}
+
 function updateWaterfall() {
     const logs = document.querySelector('.logs');
     if (!logs) {
@@ -178,21 +263,38 @@ function updateWaterfall() {
     }
 
     const startDate = new Date(logEl.sourceData.timeline.startedAt).valueOf();
-    const endDate  = new Date(logs.lastChild.sourceData.timeline.startedAt).valueOf() + logs.lastChild.sourceData.durationNano / 1_000_000;
+    const endDate  = endOf(logs.lastChild.sourceData);
 
+    updateTicks(logs, startDate, endDate);
+}
+
+// updateTicks positions waterfall ticks of logs inside container relative to
+// given time range, fan-out of every log is positioned relative to its parent.
+function updateTicks(container, startDate, endDate) {
     if (startDate === endDate) {
         return;
     }
 
     const totalDuration = endDate - startDate;
 
+    let logEl = container.firstChild;
     while (logEl) {
+        const rt = logEl.sourceData;
         const tick = logEl.firstChild.lastChild;
-        const eventStart = new Date(logEl.sourceData.timeline.startedAt).valueOf();
+        const eventStart = new Date(rt.timeline.startedAt).valueOf();
         const relativeStart = eventStart - startDate;
 
         tick.style.left = (relativeStart / totalDuration * 100) + '%';
-        tick.style.width = (logEl.sourceData.durationNano / 1_000_000) / totalDuration * 100 + '%';
+        tick.style.width = (rt.durationNano / 1_000_000) / totalDuration * 100 + '%';
+
+        const log = logByEl.get(logEl);
+        if (log && log.children) {
+            let end = rt.done ? endOf(rt) : eventStart;
+            for (const child of log.children.childNodes) {
+                end = Math.max(end, endOf(child.sourceData));
+            }
+            updateTicks(log.children, eventStart, end);
+        }
 
         logEl = logEl.nextSibling;
     }
@@ -205,27 +307,48 @@ function render(log) {
         timeline,
         done,
         duration,
+        direction,
         error
     } = log.rt;
 
-    log.el.innerHTML = `<div class="row">${req.method} ${req.url} ${ status(res) } ${ res ? formatByteLen(res.contentLength) : '' } ${ duration } ${ error ? error.message : '' }<span class="waterfall"></span></div>`;
-
-    log.el.firstChild.addEventListener('mousedown', () => {
-        activate(log);
-    });
+    // urls and errors come from the network, everything is escaped
+    log.row.innerHTML = `${ directionMark(direction) } ${ escapeHTML(req.method) } ${ escapeHTML(req.url) } ${ status(res) } ${ res ? formatByteLen(res.contentLength) : '' } ${ escapeHTML(duration) } ${ error ? escapeHTML(error.message) : '' }<span class="waterfall"></span>`;
 }
 
 function activate(log) {
-    makeActive(log.el);
+    makeActive(log.row);
     details.innerHTML = `<div> ${ expanded(log) }</div>`;
+    loadBodies(details);
 }
 
-function makeActive(el) {
+function makeActive(row) {
     if (activeLog) {
         activeLog.classList.remove('active-log');
     }
-    el.classList.add('active-log');
-    activeLog = el;
+    row.classList.add('active-log');
+    activeLog = row;
+}
+
+// large bodies are stored by the server and fetched when viewed
+function loadBodies(container) {
+    container.querySelectorAll('pre[data-body]').forEach(async (pre) => {
+        try {
+            const res = await fetch(pre.dataset.body);
+            if (!res.ok) {
+                throw new Error(res.statusText);
+            }
+            pre.textContent = formatText(await res.text(), pre.dataset.truncated === 'true');
+        } catch (e) {
+            pre.textContent = `failed to load body: ${e.message}`;
+        }
+    });
+}
+
+function directionMark(direction) {
+    if (direction === 'inbound') {
+        return '<span class="direction inbound" title="inbound">&#8601;</span>';
+    }
+    return '<span class="direction outbound" title="outbound">&#8599;</span>';
 }
 
 function status(res) {
@@ -235,7 +358,7 @@ function status(res) {
 
     const statusClass = Math.floor(res.statusCode / 100);
 
-    return `<span class="status-${statusClass}xx">${res.status}</span>`;
+    return `<span class="status-${statusClass}xx">${ escapeHTML(res.status) }</span>`;
 }
 
 function expanded(log) {
@@ -246,16 +369,19 @@ function expanded(log) {
         id,
     } = log.rt;
 
-    let body = `reqid: ${id}`;
-    body += res && res.body ?
-        `response body: <pre class="json"> ${ JSON.stringify(JSON.parse(res.body), ' ', 4) } </pre>` : '';
+    let body = `reqid: ${ escapeHTML(id) }`;
+    body += log.rt.parentId ? `<br/>parent: ${ escapeHTML(log.rt.parentId) }` : '';
+    body += log.rt.traceId ? `<br/>trace: ${ escapeHTML(log.rt.traceId) } span: ${ escapeHTML(log.rt.spanId) }` : '';
+    body += log.rt.parentSpanId ? ` parent span: ${ escapeHTML(log.rt.parentSpanId) }` : '';
+    body += req ? bodySection('request body', req, `bodies/${encodeURIComponent(id)}/request`) : '';
+    body += res ? bodySection('response body', res, `bodies/${encodeURIComponent(id)}/response`) : '';
 
-    const err = error ? `error details: <pre>${ JSON.stringify(error.details, ' ', 4) }</pre>` : '';
+    const err = error ? `error details: <pre>${ escapeHTML(JSON.stringify(error.details, ' ', 4)) }</pre>` : '';
 
     const timeline = log.rt.timeline.events.map(e => {
-        return `<div>${ e.name } - ${ (e.delay / 1000000).toFixed(1) }ms ${ payload(e) }</div>`
+        return `<div>${ escapeHTML(e.name) } - ${ (e.delay / 1000000).toFixed(1) }ms ${ escapeHTML(payload(e)) }</div>`
     });
-    timeline.push(`<div><hr/>end: ${log.rt.duration}</div>`);
+    timeline.push(`<div><hr/>end: ${ escapeHTML(log.rt.duration) }</div>`);
 
     return `
         <div>
@@ -266,6 +392,35 @@ function expanded(log) {
     `;
 }
 
+function bodySection(title, log, url) {
+    if (!log.body && !log.bodyRef) {
+        return '';
+    }
+    let truncated = log.bodyTruncated ?
+        ` <span class="truncated">truncated at capture limit, ${formatByteLen(log.bodySize)} in total</span>` : '';
+    truncated += log.bodyEncoding ? ` <span class="encoding">decoded from ${escapeHTML(log.bodyEncoding)}</span>` : '';
+    truncated += log.bodyDecodingError ? ` <span class="truncated">${escapeHTML(log.bodyDecodingError)}</span>` : '';
+    if (log.bodyRef) {
+        return `<br/>${title}:${truncated} <pre class="json" data-body="${ escapeHTML(url) }" data-truncated="${!!log.bodyTruncated}">loading...</pre>`;
+    }
+    return `<br/>${title}:${truncated} <pre class="json">${ escapeHTML(formatText(log.body, log.bodyTruncated)) }</pre>`;
+}
+
+function formatText(text, truncated) {
+    if (!truncated) {
+        try {
+            return JSON.stringify(JSON.parse(text), ' ', 4);
+        } catch (e) {
+            // not json, shown as is
+        }
+    }
+    return text;
+}
+
+function escapeHTML(s) {
+    return String(s ?? '').replace(/[&<>"']/g, c => `&#${c.charCodeAt(0)};`);
+}
+
 function payload(e) {
     if (e.name === 'GotConn') {
         if (e.payload.Reused) {
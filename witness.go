@@ -3,20 +3,26 @@ package witness
 import (
 	"context"
 	"net/http"
-	"net/http/httptrace"
 	"time"
-
-	"github.com/google/uuid"
 )
 
-type customTransport func(req *http.Request) (*http.Response, error)
+// Direction of a round trip relative to the instrumented process.
+type Direction string
 
-func (f customTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	return f(req)
-}
+const (
+	// Outbound round trips are made by instrumented http clients.
+	Outbound Direction = "outbound"
+	// Inbound round trips are handled by instrumented http handlers.
+	Inbound Direction = "inbound"
+)
 
 type RoundTripLog struct {
 	ID           string        `json:"id"`
+	Direction    Direction     `json:"direction"`
+	ParentID     string        `json:"parentId"`
+	TraceID      string        `json:"traceId"`
+	SpanID       string        `json:"spanId"`
+	ParentSpanID string        `json:"parentSpanId"`
 	RequestLog   *RequestLog   `json:"requestLog"`
 	ResponseLog  *ResponseLog  `json:"responseLog"`
 	Error        *RequestError `json:"error"`
@@ -37,14 +43,37 @@ type RequestLog struct {
 	Query  map[string][]string `json:"query"`
 	Header http.Header         `json:"header"`
 	Body   string              `json:"body"`
+	// BodySize is the number of body bytes sent, Body may hold only a prefix.
+	BodySize int64 `json:"bodySize"`
+	// BodyTruncated is set when Body is cut at capture size limit.
+	BodyTruncated bool `json:"bodyTruncated"`
+	// BodyRef refers to the body stored by the notifier instead of Body.
+	BodyRef string `json:"bodyRef,omitempty"`
+	// BodyEncoding is the content encoding Body was decoded from for display.
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+	// BodyDecodingError explains why Body is left encoded, e.g. unsupported
+	// content encoding.
+	BodyDecodingError string `json:"bodyDecodingError,omitempty"`
 }
 
 type ResponseLog struct {
+	Proto         string      `json:"proto"`
 	Status        string      `json:"status"`
 	StatusCode    int         `json:"statusCode"`
 	Header        http.Header `json:"header"`
 	ContentLength int64       `json:"contentLength"`
 	Body          string      `json:"body"`
+	// BodySize is the number of body bytes received, Body may hold only a prefix.
+	BodySize int64 `json:"bodySize"`
+	// BodyTruncated is set when Body is cut at capture size limit.
+	BodyTruncated bool `json:"bodyTruncated"`
+	// BodyRef refers to the body stored by the notifier instead of Body.
+	BodyRef string `json:"bodyRef,omitempty"`
+	// BodyEncoding is the content encoding Body was decoded from for display.
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+	// BodyDecodingError explains why Body is left encoded, e.g. unsupported
+	// content encoding.
+	BodyDecodingError string `json:"bodyDecodingError,omitempty"`
 }
 
 // Notifier interface must be implemented by a transport.
@@ -55,108 +84,79 @@ type Notifier interface {
 
 var DefaultNotifier Notifier = NewSSENotifier()
 
+// Option configures instrumentation created by Instrument, NewTransport or Middleware.
+type Option func(*Transport)
+
+// WithNotifier sets the Notifier receiving round trip logs. When omitted
+// DefaultNotifier is used, which has to be initialised by the caller.
+func WithNotifier(n Notifier) Option {
+	return func(t *Transport) {
+		t.Notifier = n
+	}
+}
+
+// WithBodyCapture enables or disables capturing of request and response bodies.
+func WithBodyCapture(enabled bool) Option {
+	return func(t *Transport) {
+		t.CaptureBody = enabled
+	}
+}
+
+// WithBodyLimit sets maximum number of captured bytes of request and
+// response bodies, see Transport.MaxRequestBodySize.
+func WithBodyLimit(request, response int64) Option {
+	return func(t *Transport) {
+		t.MaxRequestBodySize = request
+		t.MaxResponseBodySize = response
+	}
+}
+
+// WithTraceContextPropagation enables injecting of W3C traceparent header
+// into outgoing requests.
+func WithTraceContextPropagation(enabled bool) Option {
+	return func(t *Transport) {
+		t.PropagateTraceContext = enabled
+	}
+}
+
+// WithRedactor sets rules masking secrets in round trip logs before they are
+// reported, DefaultRedactor is used when omitted.
+func WithRedactor(r *Redactor) Option {
+	return func(t *Transport) {
+		t.Redactor = r
+	}
+}
+
+// WithoutRedaction reports round trips verbatim, including credentials.
+func WithoutRedaction() Option {
+	return WithRedactor(&Redactor{})
+}
+
 func DebugClient(client *http.Client, ctx context.Context) {
 	DefaultNotifier.Init(ctx)
-	InstrumentClient(client, DefaultNotifier, true)
+	Instrument(client, WithNotifier(DefaultNotifier), WithBodyCapture(true))
 }
 
+// InstrumentClient wraps transport of the client to report round trips to n.
+// It is kept for compatibility, prefer Instrument.
 func InstrumentClient(client *http.Client, n Notifier, includeBody bool) {
-	tr := client.Transport
-	if tr == nil {
-		tr = http.DefaultTransport
-	}
+	Instrument(client, WithNotifier(n), WithBodyCapture(includeBody))
+}
 
-	client.Transport = customTransport(func(req *http.Request) (*http.Response, error) {
-		var requestBody string
-		startedAt := time.Now()
-		id := uuid.NewString()
-		timeline := newTimeline(startedAt)
-		requestLog := &RequestLog{
-			Method: req.Method,
-			Url:    req.URL.String(),
-			Query:  req.URL.Query(),
-			Header: req.Header,
-			Body:   requestBody,
-		}
-		payload := &RoundTripLog{
-			ID:         id,
-			RequestLog: requestLog,
-			Timeline:   timeline,
-		}
-		trace := timeline.tracer(func() {
-			n.Notify(*payload)
-		})
-		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
-
-		var duration time.Duration
-		if includeBody {
-			req.Body = &bodyWrapper{
-				body: req.Body,
-				onReadingStart: func() {
-					timeline.logEvent("RequestBodyReadingStart", nil)
-				},
-				onReadingDone: func() {
-					timeline.logEvent("RequestBodyReadingDone", nil)
-				},
-				onClose: func(bw *bodyWrapper) {
-					timeline.logEvent("RequestBodyClosed", nil)
-					requestLog.Body = string(bw.content)
-				},
-			}
-		}
-
-		res, err := tr.RoundTrip(req)
-
-		if res != nil {
-			payload.ResponseLog = &ResponseLog{
-				Status:        string(res.Status),
-				StatusCode:    res.StatusCode,
-				Header:        res.Header,
-				ContentLength: res.ContentLength,
-			}
-			n.Notify(*payload)
-		}
-
-		if err != nil {
-			payload.Error = &RequestError{
-				Message: err.Error(),
-				Details: err,
-			}
-		}
-
-		if includeBody && res != nil && res.Body != nil {
-			res.Body = &bodyWrapper{
-				body: res.Body,
-				onReadingStart: func() {
-					timeline.logEvent("ResponseBodyReadingStart", nil)
-				},
-				onReadingDone: func() {
-					timeline.logEvent("ResponseBodyReadingDone", nil)
-				},
-				onClose: func(bw *bodyWrapper) {
-					timeline.logEvent("ResponseBodyClosed", nil)
-					duration = time.Now().Sub(startedAt)
-					payload.Done = true
-					if payload.ResponseLog != nil {
-						payload.ResponseLog.Body = string(bw.content)
-						if payload.ResponseLog.ContentLength == -1 {
-							payload.ResponseLog.ContentLength = int64(len(bw.content))
-						}
-					}
-					payload.Duration = roundDuration(duration, 1).String()
-					payload.DurationNano = duration.Nanoseconds()
-					n.Notify(*payload)
-				},
-			}
-		} else {
-			duration = time.Now().Sub(startedAt)
-			payload.Done = true
-			payload.Duration = roundDuration(duration, 1).String()
-			payload.DurationNano = duration.Nanoseconds()
-			n.Notify(*payload)
-		}
-		return res, err
-	})
+// Instrument replaces transport of the client with an eavesdropping one and
+// returns it, so that the same round tripper could be shared with other clients.
+func Instrument(client *http.Client, opts ...Option) http.RoundTripper {
+	t := NewTransport(client.Transport, opts...)
+	client.Transport = t
+	return t
+}
+
+// Wrapper returns a function suitable for WrapTransport style hooks
+// (e.g. rest.Config.Wrap in client-go) instrumenting any round tripper.
+func Wrapper(opts ...Option) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return NewTransport(rt, opts...)
+	}
 }
 
 var divs = []time.Duration{
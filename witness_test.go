@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -76,6 +78,27 @@ func TestDebugClient(t *testing.T) {
 	DebugClient(client, context.Background())
 }
 
+func TestDebugClientTwice(t *testing.T) {
+	dtStashed := DefaultNotifier
+	defer func() {
+		DefaultNotifier = dtStashed
+	}()
+	notifier := NewSSENotifier(WithSSEAddr("localhost:0"), WithSSEWaitForClients(0, 0))
+	DefaultNotifier = notifier
+
+	ctx, cancel := context.WithCancel(context.Background())
+	DebugClient(&http.Client{}, ctx)
+	url := notifier.URL()
+	DebugClient(&http.Client{}, ctx)
+	if notifier.URL() != url {
+		t.Errorf("expected server to be started once, got %s and %s", url, notifier.URL())
+	}
+	cancel()
+	if err := notifier.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestInstrumentClient(t *testing.T) {
 	t.Run("with body", func(t *testing.T) {
 		client := &http.Client{}
@@ -146,6 +169,127 @@ func TestInstrumentClient(t *testing.T) {
 	})
 }
 
+func TestInstrument(t *testing.T) {
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, r.Body)
+		}))
+	defer testServer.Close()
+
+	notifier := &fakeNotifier{}
+	client := &http.Client{}
+	rt := Instrument(client, WithNotifier(notifier), WithBodyCapture(true))
+	if client.Transport == nil {
+		t.Fatal("expected client transport to be replaced")
+	}
+
+	// the same round tripper could be reused by another client
+	other := &http.Client{Transport: rt}
+	api := API{other, testServer.URL}
+	api.SendPostRequest()
+
+	payload := notifier.payload
+	if !payload.Done {
+		t.Error("expected final payload to be reported")
+	}
+	if payload.ResponseLog.Body != "hello" {
+		t.Errorf("expected response body to be 'hello', got '%v'", payload.ResponseLog.Body)
+	}
+}
+
+// collectingNotifier keeps every snapshot and serializes it immediately, so
+// that the race detector spots any memory shared with the recorded round trip.
+type collectingNotifier struct {
+	mu        sync.Mutex
+	snapshots []RoundTripLog
+}
+
+func (n *collectingNotifier) Init(ctx context.Context) {}
+
+func (n *collectingNotifier) Notify(rtl RoundTripLog) {
+	serializeOrDie(rtl)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.snapshots = append(n.snapshots, rtl)
+}
+
+func TestConcurrentRoundTrips(t *testing.T) {
+	// run with -race to detect unsynchronized access
+	testServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, r.Body)
+		}))
+	defer testServer.Close()
+
+	notifier := &collectingNotifier{}
+	client := &http.Client{}
+	Instrument(client, WithNotifier(NewAsyncNotifier(notifier, 10000, Block)), WithBodyCapture(true))
+
+	const requests = 50
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf("request-%d", i)
+			res, err := client.Post(testServer.URL, "text/plain", strings.NewReader(body))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer res.Body.Close()
+			io.ReadAll(res.Body)
+		}(i)
+	}
+	wg.Wait()
+	client.Transport.(*Transport).Notifier.(*AsyncNotifier).Close()
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	done := map[string]RoundTripLog{}
+	for _, rtl := range notifier.snapshots {
+		if !rtl.Done {
+			continue
+		}
+		if _, seen := done[rtl.ID]; seen {
+			t.Errorf("round trip %v reported as done twice", rtl.ID)
+		}
+		done[rtl.ID] = rtl
+	}
+	if len(done) != requests {
+		t.Fatalf("expected %d completed round trips, got %d", requests, len(done))
+	}
+	for _, rtl := range done {
+		if rtl.RequestLog.Body != rtl.ResponseLog.Body {
+			t.Errorf("expected echoed body %v, got %v", rtl.RequestLog.Body, rtl.ResponseLog.Body)
+		}
+	}
+	for _, rtl := range notifier.snapshots {
+		if !rtl.Done && rtl.DurationNano != 0 {
+			t.Error("expected intermediate snapshot not to be modified after completion")
+		}
+	}
+}
+
+func TestSnapshotIsDeepCopy(t *testing.T) {
+	rtl := sampleRoundTrip("1")
+	s := rtl.snapshot()
+	rtl.RequestLog.Header.Set("Content-Type", "changed")
+	rtl.ResponseLog.Body = "changed"
+	rtl.Timeline.logEvent("Late", nil)
+
+	if s.RequestLog.Header.Get("Content-Type") != "text/plain" {
+		t.Error("expected snapshot headers not to be shared")
+	}
+	if s.ResponseLog.Body != "{}" {
+		t.Error("expected snapshot response log not to be shared")
+	}
+	if len(s.Timeline.Events) != len(rtl.Timeline.Events)-1 {
+		t.Error("expected snapshot events not to be shared")
+	}
+}
+
 type API struct {
 	Client  *http.Client
 	baseURL string